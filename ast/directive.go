@@ -0,0 +1,121 @@
+package ast
+
+import "strings"
+
+// Directives are comments that control formatting.
+//
+//	{{/* gotmplfmt:off */}} ... {{/* gotmplfmt:on */}}
+//
+// leaves everything between the two comments exactly as written.
+// If there is no gotmplfmt:on in the same list, such as the same {{ if }} body,
+// formatting stays off until the end of that list.
+//
+//	{{/* gotmplfmt:ignore */}}
+//
+// at the top level of a template leaves the entire template exactly as written.
+//
+//	{{/* gotmplfmt:type example.com/app/web.PageData */}}
+//
+// in the body of a template, such as at the top level or in a {{ define }},
+// records the type of dot in that template for tools that check field references.
+// It does not affect formatting.
+const (
+	directiveOff    = "gotmplfmt:off"
+	directiveOn     = "gotmplfmt:on"
+	directiveIgnore = "gotmplfmt:ignore"
+	directiveType   = "gotmplfmt:type"
+)
+
+// directiveText returns the trimmed text of the comment n, or "" if n is not a comment.
+func directiveText(n Node) string {
+	c, ok := n.(*CommentNode)
+	if !ok {
+		return ""
+	}
+	text := strings.TrimSuffix(strings.TrimPrefix(c.Text, leftComment), rightComment)
+	return strings.TrimSpace(text)
+}
+
+// isDirective reports whether n is a comment containing directive.
+func isDirective(n Node, directive string) bool {
+	return directiveText(n) == directive
+}
+
+// Ignored reports whether the template rooted at n contains
+// a top-level {{/* gotmplfmt:ignore */}} directive,
+// meaning that it should not be formatted at all.
+func Ignored(n Node) bool {
+	l, ok := n.(*ListNode)
+	if !ok {
+		return false
+	}
+	for _, c := range l.Nodes {
+		if isDirective(c, directiveIgnore) {
+			return true
+		}
+	}
+	return false
+}
+
+// DotType returns the type named by a gotmplfmt:type directive
+// among the nodes of l, the body of a template, and the directive itself.
+// It returns "", nil if there is no such directive.
+func DotType(l *ListNode) (string, *CommentNode) {
+	if l == nil {
+		return "", nil
+	}
+	for _, n := range l.Nodes {
+		if f := strings.Fields(directiveText(n)); len(f) == 2 && f[0] == directiveType {
+			return f[1], n.(*CommentNode)
+		}
+	}
+	return "", nil
+}
+
+// Unformatted reports whether the position p in the template rooted at n
+// lies in a gotmplfmt:off region, which the printer copies as written.
+func Unformatted(n Node, p Pos) bool {
+	for _, r := range offRegions(n) {
+		if r[0] <= p && p < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// offRegions returns the extents of the gotmplfmt:off regions in n,
+// which the printer copies verbatim.
+func offRegions(n Node) [][2]Pos {
+	var regions [][2]Pos
+	Inspect(n, func(n Node) bool {
+		l, ok := n.(*ListNode)
+		if !ok {
+			return true
+		}
+		for i := 0; i < len(l.Nodes); i++ {
+			if !isDirective(l.Nodes[i], directiveOff) {
+				continue
+			}
+			start, end := l.Nodes[i].End(), l.end
+			for i+1 < len(l.Nodes) && !isDirective(l.Nodes[i+1], directiveOn) {
+				i++
+			}
+			if i+1 < len(l.Nodes) {
+				end = l.Nodes[i+1].Position()
+			}
+			regions = append(regions, [2]Pos{start, end})
+		}
+		return true
+	})
+	return regions
+}
+
+// overlaps reports whether n overlaps any of the regions.
+func overlaps(regions [][2]Pos, n Node) bool {
+	for _, r := range regions {
+		if r[0] < n.End() && n.Position() < r[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// LineCol returns the 1-based line and byte column of p in t's source.
+func (t *Tree) LineCol(p Pos) (line, col int) {
+	text := t.text[:p]
+	line = 1 + strings.Count(text, "\n")
+	col = len(text) - strings.LastIndex(text, "\n")
+	return line, col
+}
+
+// A dumpNode is the description of a node written by Dump and DumpJSON.
+type dumpNode struct {
+	Type     string      `json:"type"`
+	Pos      dumpPos     `json:"pos"`
+	End      dumpPos     `json:"end"`
+	Keyword  string      `json:"keyword,omitempty"`
+	Trim     string      `json:"trim,omitempty"`
+	Trailing bool        `json:"trailing,omitempty"`
+	Decl     []string    `json:"decl,omitempty"`
+	Assign   bool        `json:"assign,omitempty"`
+	Value    string      `json:"value,omitempty"`
+	Children []*dumpNode `json:"children,omitempty"`
+}
+
+type dumpPos struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Col    int `json:"col"`
+}
+
+func (p dumpPos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// Dump writes a description of the tree rooted at n to w,
+// one node per line, with children indented below their parent.
+// Each line holds the node's type, its line:col extent, and its
+// keyword, trim markers, declarations, comment placement, and value,
+// where it has them.
+// Dump is intended for debugging; its output may change.
+func Dump(w io.Writer, n Node) error {
+	var sb strings.Builder
+	var dump func(d *dumpNode, depth int)
+	dump = func(d *dumpNode, depth int) {
+		sb.WriteString(strings.Repeat("\t", depth))
+		fmt.Fprintf(&sb, "%s %v-%v", d.Type, d.Pos, d.End)
+		if d.Keyword != "" {
+			fmt.Fprintf(&sb, " keyword=%s", d.Keyword)
+		}
+		if d.Trim != "" {
+			fmt.Fprintf(&sb, " trim=%s", d.Trim)
+		}
+		if d.Trailing {
+			sb.WriteString(" trailing")
+		}
+		if len(d.Decl) > 0 {
+			op := ":="
+			if d.Assign {
+				op = "="
+			}
+			fmt.Fprintf(&sb, " decl=%s%s", strings.Join(d.Decl, ","), op)
+		}
+		if d.Value != "" {
+			fmt.Fprintf(&sb, " %q", d.Value)
+		}
+		sb.WriteByte('\n')
+		for _, c := range d.Children {
+			dump(c, depth+1)
+		}
+	}
+	dump(describe(n), 0)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// DumpJSON writes a description of the tree rooted at n to w as JSON.
+// It holds the same information as Dump, plus byte offsets.
+// DumpJSON is intended for debugging and for diffing trees;
+// its output may change.
+func DumpJSON(w io.Writer, n Node) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(describe(n))
+}
+
+// describe returns the description of the tree rooted at n.
+func describe(n Node) *dumpNode {
+	var root *dumpNode
+	var stack []*dumpNode
+	Inspect(n, func(n Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		d := describeNode(n)
+		if len(stack) == 0 {
+			root = d
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, d)
+		}
+		stack = append(stack, d)
+		return true
+	})
+	return root
+}
+
+// describeNode returns the description of n alone, without its children.
+func describeNode(n Node) *dumpNode {
+	d := &dumpNode{
+		Type: strings.TrimSuffix(reflect.TypeOf(n).Elem().Name(), "Node"),
+		Pos:  describePos(n, n.Position()),
+		End:  describePos(n, n.End()),
+	}
+	switch n := n.(type) {
+	case *TextNode:
+		d.Value = n.Text
+	case *CommentNode:
+		d.Value = n.Text
+		d.Trim = n.Trim.describe()
+		d.Trailing = n.Placement == CommentTrailing
+	case *ActionNode:
+		d.Trim = n.Trim.describe()
+	case *PipeNode:
+		for _, v := range n.Decl {
+			d.Decl = append(d.Decl, v.String())
+		}
+		d.Assign = n.IsAssign
+	case *BranchNode:
+		d.Keyword = n.Keyword
+		d.Trim = n.Trim.describe()
+	case *ElseNode:
+		d.Keyword = "else"
+		if n.Pipe != nil {
+			d.Keyword = "else if"
+		}
+		d.Trim = n.Trim.describe()
+	case *EndNode:
+		d.Keyword = "end"
+		d.Trim = n.Trim.describe()
+	case *ChainNode:
+		d.Value = "." + strings.Join(n.Field, ".")
+	case *IdentifierNode, *VariableNode, *FieldNode, *BoolNode, *NumberNode, *StringNode, *DotNode, *NilNode:
+		d.Value = n.String()
+	}
+	return d
+}
+
+func describePos(n Node, p Pos) dumpPos {
+	line, col := n.Tree().LineCol(p)
+	return dumpPos{Offset: int(p), Line: line, Col: col}
+}
+
+// describe returns the trim markers in t: "left", "right", "both", or "".
+func (t Trim) describe() string {
+	switch {
+	case t.Left && t.Right:
+		return "both"
+	case t.Left:
+		return "left"
+	case t.Right:
+		return "right"
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package ast
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	const src = "{{- if $x := .A }}\n<p>{{ $x.B | f \"s\" -}}</p>{{ else }}{{/* c */ -}}{{ end }}"
+	root, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if err := Dump(&sb, root); err != nil {
+		t.Fatal(err)
+	}
+	const want = `List 1:1-2:59
+	Branch 1:1-2:59 keyword=if trim=left
+		Pipe 1:8-1:16 decl=$x:=
+			Variable 1:8-1:10 "$x"
+			Command 1:14-1:16
+				Field 1:14-1:16 ".A"
+		List 1:19-2:27
+			Text 1:19-2:4 "\n<p>"
+			Action 2:4-2:23 trim=right
+				Pipe 2:7-2:19
+					Command 2:7-2:11
+						Variable 2:7-2:11 "$x.B"
+					Command 2:14-2:19
+						Identifier 2:14-2:15 "f"
+						String 2:16-2:19 "\"s\""
+			Text 2:23-2:27 "</p>"
+		Else 2:27-2:50 keyword=else
+			List 2:37-2:50
+				Comment 2:37-2:50 trim=right trailing "/* c */"
+		End 2:50-2:59 keyword=end
+`
+	if got := sb.String(); got != want {
+		t.Errorf("Dump:\n%s\nwant:\n%s", got, want)
+	}
+
+	sb.Reset()
+	if err := DumpJSON(&sb, root); err != nil {
+		t.Fatal(err)
+	}
+	var d dumpNode
+	if err := json.Unmarshal([]byte(sb.String()), &d); err != nil {
+		t.Fatal(err)
+	}
+	action := d.Children[0].Children[1].Children[1]
+	if action.Type != "Action" || action.Trim != "right" || action.Pos != (dumpPos{Offset: 22, Line: 2, Col: 4}) {
+		t.Errorf("DumpJSON action = %+v", action)
+	}
+}
@@ -0,0 +1,134 @@
+package ast
+
+import "strings"
+
+// CollapseElseIf rewrites every
+//
+//	{{ if A }}x{{ else }}{{ if B }}y{{ end }}{{ end }}
+//
+// in n to the equivalent
+//
+//	{{ if A }}x{{ else if B }}y{{ end }}
+//
+// It leaves a chain alone unless its trim markers and whitespace
+// guarantee that the rewritten template renders identically,
+// or if it overlaps a gotmplfmt:off region.
+func CollapseElseIf(n Node) {
+	off := offRegions(n)
+	eachBranch(n, func(b *BranchNode) {
+		if !overlaps(off, b) {
+			collapseElseIf(b)
+		}
+	})
+}
+
+// ExpandElseIf is the inverse of CollapseElseIf.
+// It rewrites every {{ else if B }} in n to {{ else }}{{ if B }},
+// adding the corresponding {{ end }}.
+// It leaves alone chains that overlap a gotmplfmt:off region.
+func ExpandElseIf(n Node) {
+	off := offRegions(n)
+	eachBranch(n, func(b *BranchNode) {
+		if !overlaps(off, b) {
+			expandElseIf(b)
+		}
+	})
+}
+
+// eachBranch calls f on every BranchNode in n, innermost first.
+func eachBranch(n Node, f func(*BranchNode)) {
+	var branches []*BranchNode
+	Inspect(n, func(n Node) bool {
+		if b, ok := n.(*BranchNode); ok {
+			branches = append(branches, b)
+		}
+		return true
+	})
+	// Inspect visits parents before their children.
+	for i := len(branches) - 1; i >= 0; i-- {
+		f(branches[i])
+	}
+}
+
+func collapseElseIf(b *BranchNode) {
+	if b.Keyword != "if" || len(b.Elses) == 0 {
+		return
+	}
+	last := b.Elses[len(b.Elses)-1]
+	if last.Pipe != nil || last.List == nil {
+		return
+	}
+	// The else body must consist of a single if, possibly surrounded
+	// by whitespace that is trimmed away during execution.
+	var inner *BranchNode
+	var before, after []Node
+	for _, n := range last.List.Nodes {
+		if br, ok := n.(*BranchNode); ok && inner == nil {
+			inner = br
+			continue
+		}
+		if inner == nil {
+			before = append(before, n)
+		} else {
+			after = append(after, n)
+		}
+	}
+	if inner == nil || inner.Keyword != "if" {
+		return
+	}
+	if !trimmedAway(before, last.Trim.Right || inner.Trim.Left) {
+		return
+	}
+	if !trimmedAway(after, inner.Close.Trim.Right || b.Close.Trim.Left) {
+		return
+	}
+	elseIf := b.tr.newElse(last.Pos, last.Line, inner.Pipe, Trim{Left: last.Trim.Left, Right: inner.Trim.Right})
+	elseIf.List = inner.List
+	b.Elses = append(b.Elses[:len(b.Elses)-1], elseIf)
+	b.Elses = append(b.Elses, inner.Elses...)
+	b.Close = b.tr.newEnd(b.Close.Pos, b.Close.end, Trim{Left: inner.Close.Trim.Left, Right: b.Close.Trim.Right})
+}
+
+// trimmedAway reports whether nodes render as nothing,
+// given whether the adjacent delimiters trim them.
+func trimmedAway(nodes []Node, trimmed bool) bool {
+	for _, n := range nodes {
+		text, ok := n.(*TextNode)
+		if !ok || !trimmed || strings.TrimLeft(text.Text, spaceChars) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func expandElseIf(b *BranchNode) {
+	if b.Keyword != "if" {
+		return
+	}
+	for i, e := range b.Elses {
+		if e.Pipe == nil {
+			continue
+		}
+		inner := &BranchNode{
+			tr:       b.tr,
+			NodeType: NodeBranch,
+			Keyword:  "if",
+			Pos:      e.Pos,
+			Line:     e.Line,
+			Pipe:     e.Pipe,
+			List:     e.List,
+			Elses:    b.Elses[i+1:],
+			Close:    b.tr.newEnd(b.Close.Pos, b.Close.end, Trim{Left: b.Close.Trim.Left}),
+			Trim:     Trim{Right: e.Trim.Right},
+		}
+		// The new if may itself contain else ifs.
+		expandElseIf(inner)
+		els := b.tr.newElse(e.Pos, e.Line, nil, Trim{Left: e.Trim.Left})
+		els.List = b.tr.newList(e.Pos)
+		els.List.append(inner)
+		els.List.end = inner.End()
+		b.Elses = append(b.Elses[:i:i], els)
+		b.Close = b.tr.newEnd(b.Close.Pos, b.Close.end, Trim{Right: b.Close.Trim.Right})
+		return
+	}
+}
@@ -0,0 +1,105 @@
+package ast
+
+import (
+	"testing"
+	stdparse "text/template/parse"
+)
+
+var elseIfTests = []struct {
+	expanded  string
+	collapsed string // empty if the expanded form must not be collapsed
+}{
+	{
+		expanded:  `{{ if .A }}a{{ else }}{{ if .B }}b{{ end }}{{ end }}`,
+		collapsed: `{{ if .A }}a{{ else if .B }}b{{ end }}`,
+	},
+	{
+		expanded:  `{{ if .A }}a{{ else }}{{ if .B }}b{{ else }}{{ if .C }}c{{ else }}d{{ end }}{{ end }}{{ end }}`,
+		collapsed: `{{ if .A }}a{{ else if .B }}b{{ else if .C }}c{{ else }}d{{ end }}`,
+	},
+	{
+		expanded:  `{{- if .A -}} a {{- else -}} {{- if .B -}} b {{- end -}} {{- end -}}`,
+		collapsed: `{{- if .A -}} a {{- else if .B -}} b {{- end -}}`,
+	},
+	{
+		expanded:  "{{ if .A }}a{{ else -}}\n\t{{ if .B }}b{{ end }}\n{{- end }}",
+		collapsed: "{{ if .A }}a{{ else if .B }}b{{ end }}",
+	},
+	{
+		// Whitespace that is rendered must be kept.
+		expanded: "{{ if .A }}a{{ else }}\n{{ if .B }}b{{ end }}{{ end }}",
+	},
+	{
+		// Other content in the else must be kept.
+		expanded: "{{ if .A }}a{{ else }}{{ if .B }}b{{ end }}c{{ end }}",
+	},
+	{
+		// Only if has an else if form.
+		expanded: "{{ if .A }}a{{ else }}{{ with .B }}b{{ end }}{{ end }}",
+	},
+	{
+		expanded: "{{ range .A }}a{{ else }}{{ if .B }}b{{ end }}{{ end }}",
+	},
+}
+
+func TestCollapseElseIf(t *testing.T) {
+	for _, tt := range elseIfTests {
+		root, err := Parse(tt.expanded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		CollapseElseIf(root)
+		got := root.String()
+		want := tt.collapsed
+		if want == "" {
+			want = tt.expanded
+		}
+		if got != want {
+			t.Errorf("CollapseElseIf(%q) = %q, want %q", tt.expanded, got, want)
+		}
+		checkEquivalent(t, tt.expanded, got)
+	}
+}
+
+func TestExpandElseIf(t *testing.T) {
+	for _, tt := range elseIfTests {
+		if tt.collapsed == "" {
+			continue
+		}
+		root, err := Parse(tt.collapsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ExpandElseIf(root)
+		got := root.String()
+		checkEquivalent(t, tt.collapsed, got)
+		// Expanding then collapsing must round trip.
+		root, err = Parse(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		CollapseElseIf(root)
+		if again := root.String(); again != tt.collapsed {
+			t.Errorf("CollapseElseIf(ExpandElseIf(%q)) = %q", tt.collapsed, again)
+		}
+	}
+}
+
+// checkEquivalent checks that the standard library parses a and b to the same tree.
+func checkEquivalent(t *testing.T, a, b string) {
+	t.Helper()
+	if sa, sb := stdlibString(t, a), stdlibString(t, b); sa != sb {
+		t.Errorf("%q and %q are not equivalent:\n%s\n%s", a, b, sa, sb)
+	}
+}
+
+// stdlibString returns the text/template/parse representation of text.
+func stdlibString(t *testing.T, text string) string {
+	t.Helper()
+	tree := stdparse.New("test")
+	tree.Mode = stdparse.SkipFuncCheck
+	if _, err := tree.Parse(text, "", "", map[string]*stdparse.Tree{}); err != nil {
+		t.Fatalf("stdlib parse of %q: %v", text, err)
+	}
+	return tree.Root.String()
+}
@@ -0,0 +1,40 @@
+package ast
+
+import "testing"
+
+func FuzzParseString(f *testing.F) {
+	f.Fuzz(func(t *testing.T, s string) {
+		root, err := Parse(s)
+		if err != nil {
+			return
+		}
+		// Every node must lie within its parent.
+		var stack []Node
+		Inspect(root, func(n Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return false
+			}
+			if n.Position() > n.End() {
+				t.Fatalf("%T %q: Position %d > End %d", n, n, n.Position(), n.End())
+			}
+			if len(stack) > 0 {
+				p := stack[len(stack)-1]
+				if n.Position() < p.Position() || n.End() > p.End() {
+					t.Fatalf("%T %q [%d,%d) not within %T [%d,%d)", n, n, n.Position(), n.End(), p, p.Position(), p.End())
+				}
+			}
+			stack = append(stack, n)
+			return true
+		})
+		out := root.String()
+		root2, err := Parse(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out2 := root2.String()
+		if out != out2 {
+			t.Fatalf("round trip failure: %q != %q", out, out2)
+		}
+	})
+}
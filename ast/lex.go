@@ -2,7 +2,7 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package parse
+package ast
 
 import (
 	"fmt"
@@ -17,7 +17,12 @@ type item struct {
 	pos  Pos      // The starting position, in bytes, of this item in the input string.
 	val  string   // The value of this item.
 	line int      // The line number at the start of this item.
-	trim trim     // trim markers associated with this item (itemLeftDelim, itemRightDelim)
+	trim Trim     // trim markers associated with this item (itemLeftDelim, itemRightDelim, itemComment)
+}
+
+// end returns the position just past the end of the item.
+func (i item) end() Pos {
+	return i.pos + Pos(len(i.val))
 }
 
 func (i item) String() string {
@@ -150,7 +155,7 @@ func (l *lexer) backup() {
 // thisItem returns the item at the current input point with the specified type
 // and advances the input.
 func (l *lexer) thisItem(t itemType) item {
-	i := item{t, l.start, l.input[l.start:l.pos], l.startLine, trim{}}
+	i := item{t, l.start, l.input[l.start:l.pos], l.startLine, Trim{}}
 	l.start = l.pos
 	l.startLine = l.line
 	return i
@@ -195,7 +200,7 @@ func (l *lexer) acceptRun(valid string) {
 // errorf returns an error token and terminates the scan by passing
 // back a nil pointer that will be the next state, terminating l.nextItem.
 func (l *lexer) errorf(format string, args ...any) stateFn {
-	l.item = item{itemError, l.start, fmt.Sprintf(format, args...), l.startLine, trim{}}
+	l.item = item{itemError, l.start, fmt.Sprintf(format, args...), l.startLine, Trim{}}
 	l.start = 0
 	l.pos = 0
 	l.input = l.input[:0]
@@ -205,7 +210,7 @@ func (l *lexer) errorf(format string, args ...any) stateFn {
 // nextItem returns the next item from the input.
 // Called by the parser, not in the lexing goroutine.
 func (l *lexer) nextItem() item {
-	l.item = item{itemEOF, l.pos, "EOF", l.startLine, trim{}}
+	l.item = item{itemEOF, l.pos, "EOF", l.startLine, Trim{}}
 	state := lexText
 	if l.insideAction {
 		state = lexInsideAction
@@ -291,7 +296,7 @@ func lexLeftDelim(l *lexer) stateFn {
 		return lexComment
 	}
 	i := l.thisItem(itemLeftDelim)
-	i.trim.left = trimSpace
+	i.trim.Left = trimSpace
 	l.insideAction = true
 	l.pos += afterMarker
 	l.ignore()
@@ -312,13 +317,13 @@ func lexComment(l *lexer) stateFn {
 		return l.errorf("comment ends before closing delimiter")
 	}
 	i := l.thisItem(itemComment)
+	// lexLeftDelim consumed any left trim marker; look back for it.
+	i.trim.Left = i.pos >= trimMarkerLen && hasLeftTrimMarker(l.input[i.pos-trimMarkerLen:])
+	i.trim.Right = trimSpace
 	if trimSpace {
 		l.pos += trimMarkerLen
 	}
 	l.pos += Pos(len(rightDelim))
-	if trimSpace {
-		l.pos += leftTrimLength(l.input[l.pos:])
-	}
 	l.ignore()
 	return l.emitItem(i)
 }
@@ -332,7 +337,7 @@ func lexRightDelim(l *lexer) stateFn {
 	}
 	l.pos += Pos(len(rightDelim))
 	i := l.thisItem(itemRightDelim)
-	i.trim.right = trimSpace
+	i.trim.Right = trimSpace
 	l.insideAction = false
 	return l.emitItem(i)
 }
@@ -635,26 +640,44 @@ func hasRightTrimMarker(s string) bool {
 	return len(s) >= 2 && isSpace(rune(s[0])) && s[1] == trimMarker
 }
 
-type trim struct {
-	left, right bool
+// Trim records the trim markers on an action's delimiters.
+type Trim struct {
+	Left  bool // The left delimiter has a trim marker: {{-
+	Right bool // The right delimiter has a trim marker: -}}
 }
 
-func (t trim) leftDelim() string {
-	if t.left {
+func (t Trim) leftDelim() string {
+	if t.Left {
 		return "{{- "
 	}
 	return "{{ "
 }
 
-func (t trim) rightDelim() string {
-	if t.right {
+func (t Trim) rightDelim() string {
+	if t.Right {
 		return " -}}"
 	}
 	return " }}"
 }
 
-func (t trim) rightDelimNoSpace() string {
-	if t.right {
+// commentLeftDelim and commentRightDelim are like leftDelim and rightDelim,
+// but without the spaces, which comments may not have unless trimmed.
+func (t Trim) commentLeftDelim() string {
+	if t.Left {
+		return "{{- "
+	}
+	return "{{"
+}
+
+func (t Trim) commentRightDelim() string {
+	if t.Right {
+		return " -}}"
+	}
+	return "}}"
+}
+
+func (t Trim) rightDelimNoSpace() string {
+	if t.Right {
 		return "-}}"
 	}
 	return "}}"
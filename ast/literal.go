@@ -0,0 +1,154 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CanonicalizeStrings rewrites every string literal in n to its canonical spelling.
+// The canonical spelling of a string is its interpreted form ("...")
+// unless that requires escapes that its raw form (`...`) avoids.
+// Tabs are always escaped, because they are invisible in raw strings.
+// The value of the string never changes.
+func CanonicalizeStrings(n Node) {
+	eachPipe(n, func(p *PipeNode) {
+		for _, c := range p.Cmds {
+			for _, arg := range c.Args {
+				if s, ok := arg.(*StringNode); ok {
+					s.Quoted = canonicalString(s.Text)
+				}
+			}
+		}
+	})
+}
+
+// canonicalString returns the canonical spelling of a string literal with value s.
+// A raw string is used only when it avoids escapes and every rune in it is printable,
+// so that invisible runes such as U+00A0, which strconv.Quote escapes, stay visible.
+func canonicalString(s string) string {
+	q := strconv.Quote(s)
+	if strings.Contains(q, `\`) && strconv.CanBackquote(s) && isPrint(s) {
+		return "`" + s + "`"
+	}
+	return q
+}
+
+// isPrint reports whether every rune in s is printable, as defined by strconv.IsPrint.
+func isPrint(s string) bool {
+	for _, r := range s {
+		if !strconv.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// CanonicalizeNumbers rewrites every number literal in n to its canonical spelling:
+// lowercase base prefixes and exponents, and no redundant + signs.
+// For example, 0X1F becomes 0x1F, 1E+3 becomes 1e3, and +1.5 becomes 1.5.
+// Character constants and digit separators are left alone.
+// A number is only rewritten if it parses identically afterwards;
+// for example, +1 is kept, because unlike 1, it cannot be parsed as an unsigned integer.
+func CanonicalizeNumbers(n Node) {
+	eachPipe(n, func(p *PipeNode) {
+		for _, c := range p.Cmds {
+			for _, arg := range c.Args {
+				if num, ok := arg.(*NumberNode); ok {
+					num.canonicalize()
+				}
+			}
+		}
+	})
+}
+
+func (n *NumberNode) canonicalize() {
+	if strings.HasPrefix(n.Text, "'") {
+		return
+	}
+	text, size := canonicalNumber(n.Text)
+	typ := itemNumber
+	if size < len(n.Text) {
+		// Complex: 1+2i. Keep the sign joining the parts.
+		imag, _ := canonicalNumber(n.Text[size+1:])
+		text += n.Text[size:size+1] + imag
+		typ = itemComplex
+	}
+	// Paranoia: make sure that the value is unchanged.
+	canon, err := n.tr.newNumber(n.Pos, text, typ)
+	if err != nil || !canon.sameValue(n) {
+		return
+	}
+	n.Text = text
+}
+
+// sameValue reports whether n and m represent the same value.
+func (n *NumberNode) sameValue(m *NumberNode) bool {
+	return n.IsInt == m.IsInt && n.IsUint == m.IsUint && n.IsFloat == m.IsFloat && n.IsComplex == m.IsComplex &&
+		n.Int64 == m.Int64 && n.Uint64 == m.Uint64 && n.Float64 == m.Float64 && n.Complex128 == m.Complex128
+}
+
+// canonicalNumber returns the canonical spelling of the number at the start of s,
+// along with the number of bytes of s that it consumed.
+// It follows the same rules as lexer.scanNumber.
+func canonicalNumber(s string) (string, int) {
+	var b strings.Builder
+	i := 0
+	accept := func(valid string) bool {
+		if i < len(s) && strings.IndexByte(valid, s[i]) >= 0 {
+			i++
+			return true
+		}
+		return false
+	}
+	acceptRun := func(valid string) {
+		start := i
+		for accept(valid) {
+		}
+		b.WriteString(s[start:i])
+	}
+	// Optional leading sign.
+	if accept("+") {
+		// Redundant.
+	} else if accept("-") {
+		b.WriteByte('-')
+	}
+	digits := "0123456789_"
+	if accept("0") {
+		b.WriteByte('0')
+		if accept("xX") {
+			b.WriteByte('x')
+			digits = "0123456789abcdefABCDEF_"
+		} else if accept("oO") {
+			b.WriteByte('o')
+			digits = "01234567_"
+		} else if accept("bB") {
+			b.WriteByte('b')
+			digits = "01_"
+		}
+	}
+	acceptRun(digits)
+	if accept(".") {
+		b.WriteByte('.')
+		acceptRun(digits)
+	}
+	exp := ""
+	if len(digits) == 10+1 && accept("eE") {
+		exp = "e"
+	}
+	if len(digits) == 16+6+1 && accept("pP") {
+		exp = "p"
+	}
+	if exp != "" {
+		b.WriteString(exp)
+		if accept("-") {
+			b.WriteByte('-')
+		} else {
+			accept("+")
+		}
+		acceptRun("0123456789_")
+	}
+	if accept("i") {
+		b.WriteByte('i')
+	}
+	return b.String(), i
+}
@@ -0,0 +1,95 @@
+package ast
+
+import (
+	"strconv"
+	"testing"
+)
+
+var stringTests = []struct {
+	in, want string
+}{
+	{`"a"`, `"a"`},
+	{"`a`", `"a"`},
+	{`"a\"b"`, "`a\"b`"},
+	{"`a\"b`", "`a\"b`"},
+	{`"a\\b"`, "`a\\b`"},
+	{`"\x61"`, `"a"`},
+	{`"é"`, `"é"`},
+	{`"a\nb"`, `"a\nb"`},
+	{"`a\nb`", `"a\nb"`},
+	{"`a\tb`", `"a\tb"`},
+	{"\"`\\\"\"", "\"`\\\"\""},
+	{`"\x00"`, `"\x00"`},
+	{`"a\"\u00a0"`, `"a\"\u00a0"`},
+	{"`a\"\u00a0`", `"a\"\u00a0"`},
+}
+
+func TestCanonicalizeStrings(t *testing.T) {
+	for _, tt := range stringTests {
+		root, err := Parse("{{ f " + tt.in + " }}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		CanonicalizeStrings(root)
+		got := root.String()
+		if want := "{{ f " + tt.want + " }}"; got != want {
+			t.Errorf("CanonicalizeStrings(%s) = %s, want %s", tt.in, got, want)
+		}
+		orig, _ := strconv.Unquote(tt.in)
+		canon, err := strconv.Unquote(tt.want)
+		if err != nil || canon != orig {
+			t.Errorf("canonical spelling %s of %s has value %q, want %q", tt.want, tt.in, canon, orig)
+		}
+	}
+}
+
+var numberTests = []struct {
+	in, want string
+}{
+	{"1", "1"},
+	{"+1", "+1"}, // strconv.ParseUint rejects +1, so the parsed fields differ
+	{"+1.5", "1.5"},
+	{"-1", "-1"},
+	{"0X1F", "0x1F"},
+	{"0x1f", "0x1f"},
+	{"0B101", "0b101"},
+	{"0O17", "0o17"},
+	{"017", "017"},
+	{"1_000", "1_000"},
+	{"1E3", "1e3"},
+	{"1E+3", "1e3"},
+	{"1.5E-3", "1.5e-3"},
+	{"+.5", ".5"},
+	{"0X1P+2", "0x1p2"},
+	{"0x1.8P-2", "0x1.8p-2"},
+	{"1I", "1I"}, // not a number
+	{"2i", "2i"},
+	{"+1E2+2E+1i", "1e2+2e1i"},
+	{"0X1e+2i", "0x1e+2i"},
+	{"1-0X2P+1i", "1-0x2p1i"},
+	{"'a'", "'a'"},
+	{`'\x41'`, `'\x41'`},
+}
+
+func TestCanonicalizeNumbers(t *testing.T) {
+	for _, tt := range numberTests {
+		root, err := Parse("{{ f " + tt.in + " }}")
+		if err != nil {
+			continue // not a number
+		}
+		before := *root.(*ListNode).Nodes[0].(*ActionNode).Pipe.Cmds[0].Args[1].(*NumberNode)
+		CanonicalizeNumbers(root)
+		got := root.String()
+		if want := "{{ f " + tt.want + " }}"; got != want {
+			t.Errorf("CanonicalizeNumbers(%s) = %s, want %s", tt.in, got, want)
+		}
+		root, err = Parse(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after := root.(*ListNode).Nodes[0].(*ActionNode).Pipe.Cmds[0].Args[1].(*NumberNode)
+		if !before.sameValue(after) {
+			t.Errorf("CanonicalizeNumbers(%s) changed value from %+v to %+v", tt.in, before, after)
+		}
+	}
+}
@@ -4,7 +4,7 @@
 
 // Parse nodes.
 
-package parse
+package ast
 
 import (
 	"fmt"
@@ -14,18 +14,13 @@ import (
 
 var textFormat = "%s" // Changed to "%q" in tests for better error messages.
 
-// A Node is an element in the parse tree. The interface is trivial.
-// The interface contains an unexported method so that only
-// types local to this package can satisfy it.
+// A Node is an element in the parse tree.
 type Node interface {
 	Type() NodeType
-	String() string
-	Position() Pos // byte position of start of node in full original input string
-	// tree returns the containing *Tree.
-	// It is unexported so all implementations of Node are in this package.
-	tree() *Tree
-	// writeTo writes the String output to the builder.
-	writeTo(*printer)
+	String() string // String returns the formatted node.
+	Position() Pos  // byte position of start of node in full original input string
+	End() Pos       // byte position just past the end of node in full original input string
+	Tree() *Tree    // Tree returns the containing *Tree.
 }
 
 // NodeType identifies the type of a parse tree node.
@@ -33,62 +28,17 @@ type NodeType int
 
 // Pos represents a byte position in the original input text from which
 // this template was parsed.
+//
+// The extent of a node, from its Position to its End, covers all of its
+// original text, including delimiters, trim markers, and parentheses.
+// Nodes created or modified by rewrites such as Simplify
+// report the extent of the text they replace, approximately.
 type Pos int
 
 func (p Pos) Position() Pos {
 	return p
 }
 
-type printer struct {
-	*strings.Builder
-	prefix string
-	depth  int
-}
-
-func newPrinter() *printer {
-	return &printer{
-		Builder: new(strings.Builder),
-	}
-}
-
-func (p *printer) WritePrefix() {
-	p.WriteString(p.prefix)
-	p.WriteString(strings.Repeat("\t", p.depth))
-}
-
-func lineno(n Node) int {
-	// TODO: common uses will be quadratic!
-	// it would be easy to put in place a simple lookup structure instead at some point
-	return strings.Count(n.tree().text[:n.Position()], "\n")
-}
-
-// whitespacePrefix returns the exact whitespace from the beginning of n's line to n.
-// start is the token that starts n, e.g. "{{" or "(".
-// If there is any non-whitespace, it returns "", false.
-// For example, for a line that begins "\t\t{{ " it will return "\t\t", true,
-// but "\tx\t{{ " will yield "", false.
-func whitespacePrefix(n Node, ltok string) (string, bool) {
-	txt := n.tree().text
-	pos := n.Position()
-	start := strings.LastIndex(txt[:pos], "\n")
-	if start < 0 {
-		// First line.
-		start = 0
-	}
-	line := txt[start+1 : pos]
-	tokIdx := strings.LastIndex(line, ltok)
-	if tokIdx < 0 {
-		// unexpected!
-		return "", false
-	}
-	line = line[:tokIdx]
-	w := int(leftTrimLength(line)) // length of whitespace
-	if w != len(line) {
-		return "", false
-	}
-	return line, true
-}
-
 // Type returns itself and provides an easy default implementation
 // for embedding in a Node. Embedded in all non-trivial Nodes.
 func (t NodeType) Type() NodeType {
@@ -102,8 +52,8 @@ const (
 	NodeChain                      // A sequence of field accesses.
 	NodeCommand                    // An element of a pipeline.
 	NodeDot                        // The cursor, dot.
-	nodeElse                       // An else action. Not added to tree.
-	nodeEnd                        // An end action. Not added to tree.
+	NodeElse                       // An else action. Held by BranchNode.Elses.
+	NodeEnd                        // An end action. Held by BranchNode.Close.
 	NodeField                      // A field or method name.
 	NodeIdentifier                 // An identifier; always a function name.
 	NodeBranch                     // A branch-y action.
@@ -125,6 +75,7 @@ type ListNode struct {
 	Pos
 	tr    *Tree
 	Nodes []Node // The element nodes in lexical order.
+	end   Pos    // byte position of the end of the list, such as the {{ end }} that terminates it
 }
 
 func (t *Tree) newList(pos Pos) *ListNode {
@@ -135,25 +86,20 @@ func (l *ListNode) append(n Node) {
 	l.Nodes = append(l.Nodes, n)
 }
 
-func (l *ListNode) tree() *Tree {
+func (l *ListNode) End() Pos {
+	return l.end
+}
+
+func (l *ListNode) Tree() *Tree {
 	return l.tr
 }
 
 func (l *ListNode) String() string {
 	p := newPrinter()
-	l.writeTo(p)
+	p.print(l)
 	return p.String()
 }
 
-func (l *ListNode) writeTo(sb *printer) {
-	if l == nil {
-		return
-	}
-	for _, n := range l.Nodes {
-		n.writeTo(sb)
-	}
-}
-
 // TextNode holds plain text.
 type TextNode struct {
 	NodeType
@@ -170,39 +116,55 @@ func (t *TextNode) String() string {
 	return fmt.Sprintf(textFormat, t.Text)
 }
 
-func (t *TextNode) writeTo(sb *printer) {
-	sb.WriteString(t.String())
+func (t *TextNode) End() Pos {
+	return t.Pos + Pos(len(t.Text))
 }
 
-func (t *TextNode) tree() *Tree {
+func (t *TextNode) Tree() *Tree {
 	return t.tr
 }
 
 // CommentNode holds a comment.
+// A comment is always an entire action, {{/* ... */}},
+// because text/template does not allow comments inside other actions.
 type CommentNode struct {
 	NodeType
 	Pos
-	tr   *Tree
-	Text string // Comment text.
+	tr        *Tree
+	Text      string // Comment text.
+	Trim      Trim
+	Placement CommentPlacement
+	end       Pos
 }
 
-func (t *Tree) newComment(pos Pos, text string) *CommentNode {
-	return &CommentNode{tr: t, NodeType: NodeComment, Pos: pos, Text: text}
+// A CommentPlacement describes where a comment sits on its line.
+type CommentPlacement int
+
+const (
+	CommentOwnLine  CommentPlacement = iota // Only whitespace precedes the comment on its line.
+	CommentTrailing                         // The comment follows other text or actions on its line.
+)
+
+func (t *Tree) newComment(pos, end Pos, text string, trim Trim) *CommentNode {
+	c := &CommentNode{tr: t, NodeType: NodeComment, Pos: pos, Text: text, Trim: trim, end: end}
+	line := t.text[strings.LastIndex(t.text[:pos], "\n")+1 : pos]
+	if strings.TrimLeft(line, spaceChars) != "" {
+		c.Placement = CommentTrailing
+	}
+	return c
 }
 
 func (c *CommentNode) String() string {
 	sb := newPrinter()
-	c.writeTo(sb)
+	sb.print(c)
 	return sb.String()
 }
 
-func (c *CommentNode) writeTo(sb *printer) {
-	sb.WriteString("{{")
-	sb.WriteString(c.Text)
-	sb.WriteString("}}")
+func (c *CommentNode) End() Pos {
+	return c.end
 }
 
-func (c *CommentNode) tree() *Tree {
+func (c *CommentNode) Tree() *Tree {
 	return c.tr
 }
 
@@ -215,6 +177,7 @@ type PipeNode struct {
 	IsAssign bool            // The variables are being assigned, not declared.
 	Decl     []*VariableNode // Variables in lexical order.
 	Cmds     []*CommandNode  // The commands in lexical order.
+	end      Pos
 }
 
 func (t *Tree) newPipeline(pos Pos, line int, vars []*VariableNode) *PipeNode {
@@ -227,33 +190,15 @@ func (p *PipeNode) append(command *CommandNode) {
 
 func (p *PipeNode) String() string {
 	sb := newPrinter()
-	p.writeTo(sb)
+	sb.print(p)
 	return sb.String()
 }
 
-func (p *PipeNode) writeTo(sb *printer) {
-	if len(p.Decl) > 0 {
-		for i, v := range p.Decl {
-			if i > 0 {
-				sb.WriteString(", ")
-			}
-			v.writeTo(sb)
-		}
-		if p.IsAssign {
-			sb.WriteString(" = ")
-		} else {
-			sb.WriteString(" := ")
-		}
-	}
-	for i, c := range p.Cmds {
-		if i > 0 {
-			sb.WriteString(" | ")
-		}
-		c.writeTo(sb)
-	}
+func (p *PipeNode) End() Pos {
+	return p.end
 }
 
-func (p *PipeNode) tree() *Tree {
+func (p *PipeNode) Tree() *Tree {
 	return p.tr
 }
 
@@ -266,38 +211,25 @@ type ActionNode struct {
 	tr   *Tree
 	Line int       // The line number in the input. Deprecated: Kept for compatibility.
 	Pipe *PipeNode // The pipeline in the action.
-	Trim trim
+	Trim Trim
+	end  Pos
 }
 
-func (t *Tree) newAction(pos Pos, line int, pipe *PipeNode, trim trim) *ActionNode {
-	return &ActionNode{tr: t, NodeType: NodeAction, Pos: pos, Line: line, Pipe: pipe, Trim: trim}
+func (t *Tree) newAction(pos, end Pos, line int, pipe *PipeNode, trim Trim) *ActionNode {
+	return &ActionNode{tr: t, NodeType: NodeAction, Pos: pos, Line: line, Pipe: pipe, Trim: trim, end: end}
 }
 
 func (a *ActionNode) String() string {
 	sb := newPrinter()
-	a.writeTo(sb)
+	sb.print(a)
 	return sb.String()
 }
 
-func (a *ActionNode) writeTo(sb *printer) {
-	w, ok := whitespacePrefix(a, "{{")
-	sb.prefix = w
-	sb.WriteString(a.Trim.leftDelim())
-	before := strings.Count(sb.String(), "\n")
-	sb.depth = 1
-	a.Pipe.writeTo(sb)
-	sb.depth = 0
-	after := strings.Count(sb.String(), "\n")
-	if ok && before != after {
-		sb.WriteString("\n")
-		sb.WritePrefix()
-		sb.WriteString(a.Trim.rightDelimNoSpace())
-	} else {
-		sb.WriteString(a.Trim.rightDelim())
-	}
+func (a *ActionNode) End() Pos {
+	return a.end
 }
 
-func (a *ActionNode) tree() *Tree {
+func (a *ActionNode) Tree() *Tree {
 	return a.tr
 }
 
@@ -307,7 +239,7 @@ type CommandNode struct {
 	Pos
 	tr   *Tree
 	Args []Node // Arguments in lexical order: Identifier, field, or constant.
-	Trim trim
+	Trim Trim
 }
 
 func (t *Tree) newCommand(pos Pos) *CommandNode {
@@ -320,47 +252,18 @@ func (c *CommandNode) append(arg Node) {
 
 func (c *CommandNode) String() string {
 	sb := newPrinter()
-	c.writeTo(sb)
+	sb.print(c)
 	return sb.String()
 }
 
-func (c *CommandNode) writeTo(sb *printer) {
+func (c *CommandNode) End() Pos {
 	if len(c.Args) == 0 {
-		return
-	}
-	var prevLine int
-	for i, arg := range c.Args {
-		// TODO: quadratic!!!
-		line := lineno(arg)
-		if i > 0 {
-			if line > prevLine {
-				// TODO: preserve blank lines in input? That'd be: sb.WriteString(strings.Repeat("\n", line-prevLine))
-				sb.WriteString("\n")
-				sb.WritePrefix()
-			} else {
-				sb.WriteByte(' ')
-			}
-		}
-		prevLine = line
-		if arg, ok := arg.(*PipeNode); ok {
-			sb.WriteByte('(')
-			before := strings.Count(sb.String(), "\n")
-			sb.depth++
-			arg.writeTo(sb)
-			sb.depth--
-			after := strings.Count(sb.String(), "\n")
-			if ok && before != after {
-				sb.WriteString("\n")
-				sb.WritePrefix()
-			}
-			sb.WriteByte(')')
-			continue
-		}
-		arg.writeTo(sb)
+		return c.Pos
 	}
+	return c.Args[len(c.Args)-1].End()
 }
 
-func (c *CommandNode) tree() *Tree {
+func (c *CommandNode) Tree() *Tree {
 	return c.tr
 }
 
@@ -397,11 +300,11 @@ func (i *IdentifierNode) String() string {
 	return i.Ident
 }
 
-func (i *IdentifierNode) writeTo(sb *printer) {
-	sb.WriteString(i.String())
+func (i *IdentifierNode) End() Pos {
+	return i.Pos + Pos(len(i.Ident))
 }
 
-func (i *IdentifierNode) tree() *Tree {
+func (i *IdentifierNode) Tree() *Tree {
 	return i.tr
 }
 
@@ -420,20 +323,15 @@ func (t *Tree) newVariable(pos Pos, ident string) *VariableNode {
 
 func (v *VariableNode) String() string {
 	sb := newPrinter()
-	v.writeTo(sb)
+	sb.print(v)
 	return sb.String()
 }
 
-func (v *VariableNode) writeTo(sb *printer) {
-	for i, id := range v.Ident {
-		if i > 0 {
-			sb.WriteByte('.')
-		}
-		sb.WriteString(id)
-	}
+func (v *VariableNode) End() Pos {
+	return v.Pos + Pos(len(strings.Join(v.Ident, ".")))
 }
 
-func (v *VariableNode) tree() *Tree {
+func (v *VariableNode) Tree() *Tree {
 	return v.tr
 }
 
@@ -459,11 +357,11 @@ func (d *DotNode) String() string {
 	return "."
 }
 
-func (d *DotNode) writeTo(sb *printer) {
-	sb.WriteString(d.String())
+func (d *DotNode) End() Pos {
+	return d.Pos + Pos(len("."))
 }
 
-func (d *DotNode) tree() *Tree {
+func (d *DotNode) Tree() *Tree {
 	return d.tr
 }
 
@@ -489,11 +387,11 @@ func (n *NilNode) String() string {
 	return "nil"
 }
 
-func (n *NilNode) writeTo(sb *printer) {
-	sb.WriteString(n.String())
+func (n *NilNode) End() Pos {
+	return n.Pos + Pos(len("nil"))
 }
 
-func (n *NilNode) tree() *Tree {
+func (n *NilNode) Tree() *Tree {
 	return n.tr
 }
 
@@ -513,18 +411,15 @@ func (t *Tree) newField(pos Pos, ident string) *FieldNode {
 
 func (f *FieldNode) String() string {
 	sb := newPrinter()
-	f.writeTo(sb)
+	sb.print(f)
 	return sb.String()
 }
 
-func (f *FieldNode) writeTo(sb *printer) {
-	for _, id := range f.Ident {
-		sb.WriteByte('.')
-		sb.WriteString(id)
-	}
+func (f *FieldNode) End() Pos {
+	return f.Pos + Pos(len(f.String()))
 }
 
-func (f *FieldNode) tree() *Tree {
+func (f *FieldNode) Tree() *Tree {
 	return f.tr
 }
 
@@ -557,25 +452,19 @@ func (c *ChainNode) Add(field string) {
 
 func (c *ChainNode) String() string {
 	sb := newPrinter()
-	c.writeTo(sb)
+	sb.print(c)
 	return sb.String()
 }
 
-func (c *ChainNode) writeTo(sb *printer) {
-	if _, ok := c.Node.(*PipeNode); ok {
-		sb.WriteByte('(')
-		c.Node.writeTo(sb)
-		sb.WriteByte(')')
-	} else {
-		c.Node.writeTo(sb)
-	}
+func (c *ChainNode) End() Pos {
+	end := c.Node.End()
 	for _, field := range c.Field {
-		sb.WriteByte('.')
-		sb.WriteString(field)
+		end += Pos(len(".") + len(field))
 	}
+	return end
 }
 
-func (c *ChainNode) tree() *Tree {
+func (c *ChainNode) Tree() *Tree {
 	return c.tr
 }
 
@@ -598,11 +487,11 @@ func (b *BoolNode) String() string {
 	return "false"
 }
 
-func (b *BoolNode) writeTo(sb *printer) {
-	sb.WriteString(b.String())
+func (b *BoolNode) End() Pos {
+	return b.Pos + Pos(len(b.String()))
 }
 
-func (b *BoolNode) tree() *Tree {
+func (b *BoolNode) Tree() *Tree {
 	return b.tr
 }
 
@@ -622,10 +511,11 @@ type NumberNode struct {
 	Float64    float64    // The floating-point value.
 	Complex128 complex128 // The complex value.
 	Text       string     // The original textual representation from the input.
+	end        Pos
 }
 
 func (t *Tree) newNumber(pos Pos, text string, typ itemType) (*NumberNode, error) {
-	n := &NumberNode{tr: t, NodeType: NodeNumber, Pos: pos, Text: text}
+	n := &NumberNode{tr: t, NodeType: NodeNumber, Pos: pos, Text: text, end: pos + Pos(len(text))}
 	switch typ {
 	case itemCharConstant:
 		rune, _, tail, err := strconv.UnquoteChar(text[1:], text[0])
@@ -731,11 +621,11 @@ func (n *NumberNode) String() string {
 	return n.Text
 }
 
-func (n *NumberNode) writeTo(sb *printer) {
-	sb.WriteString(n.String())
+func (n *NumberNode) End() Pos {
+	return n.end
 }
 
-func (n *NumberNode) tree() *Tree {
+func (n *NumberNode) Tree() *Tree {
 	return n.tr
 }
 
@@ -746,21 +636,22 @@ type StringNode struct {
 	tr     *Tree
 	Quoted string // The original text of the string, with quotes.
 	Text   string // The string, after quote processing.
+	end    Pos
 }
 
 func (t *Tree) newString(pos Pos, orig, text string) *StringNode {
-	return &StringNode{tr: t, NodeType: NodeString, Pos: pos, Quoted: orig, Text: text}
+	return &StringNode{tr: t, NodeType: NodeString, Pos: pos, Quoted: orig, Text: text, end: pos + Pos(len(orig))}
 }
 
 func (s *StringNode) String() string {
 	return s.Quoted
 }
 
-func (s *StringNode) writeTo(sb *printer) {
-	sb.WriteString(s.String())
+func (s *StringNode) End() Pos {
+	return s.end
 }
 
-func (s *StringNode) tree() *Tree {
+func (s *StringNode) Tree() *Tree {
 	return s.tr
 }
 
@@ -769,26 +660,25 @@ type EndNode struct {
 	NodeType
 	Pos
 	tr   *Tree
-	Trim trim
+	Trim Trim
+	end  Pos
 }
 
-func (t *Tree) newEnd(pos Pos, trim trim) *EndNode {
-	return &EndNode{tr: t, NodeType: nodeEnd, Pos: pos, Trim: trim}
+func (t *Tree) newEnd(pos, end Pos, trim Trim) *EndNode {
+	return &EndNode{tr: t, NodeType: NodeEnd, Pos: pos, Trim: trim, end: end}
 }
 
 func (e *EndNode) String() string {
 	sb := newPrinter()
-	e.writeTo(sb)
+	sb.print(e)
 	return sb.String()
 }
 
-func (e *EndNode) writeTo(sb *printer) {
-	sb.WriteString(e.Trim.leftDelim())
-	sb.WriteString("end")
-	sb.WriteString(e.Trim.rightDelim())
+func (e *EndNode) End() Pos {
+	return e.end
 }
 
-func (e *EndNode) tree() *Tree {
+func (e *EndNode) Tree() *Tree {
 	return e.tr
 }
 
@@ -800,35 +690,28 @@ type ElseNode struct {
 	Pipe *PipeNode // guard check, may be nil for bare {{ else }}
 	List *ListNode // stuff to execute if pipe holds
 	Line int       // The line number in the input. Deprecated: Kept for compatibility.
-	Trim trim
+	Trim Trim
 }
 
-func (t *Tree) newElse(pos Pos, line int, pipe *PipeNode, trim trim) *ElseNode {
-	return &ElseNode{tr: t, NodeType: nodeElse, Pos: pos, Line: line, Pipe: pipe, Trim: trim}
+func (t *Tree) newElse(pos Pos, line int, pipe *PipeNode, trim Trim) *ElseNode {
+	return &ElseNode{tr: t, NodeType: NodeElse, Pos: pos, Line: line, Pipe: pipe, Trim: trim}
 }
 
 func (e *ElseNode) Type() NodeType {
-	return nodeElse
+	return NodeElse
 }
 
 func (e *ElseNode) String() string {
 	sb := newPrinter()
-	e.writeTo(sb)
+	sb.print(e)
 	return sb.String()
 }
 
-func (e *ElseNode) writeTo(sb *printer) {
-	sb.WriteString(e.Trim.leftDelim())
-	sb.WriteString("else")
-	if e.Pipe != nil {
-		sb.WriteString(" if ")
-		e.Pipe.writeTo(sb)
-	}
-	sb.WriteString(e.Trim.rightDelim())
-	e.List.writeTo(sb)
+func (e *ElseNode) End() Pos {
+	return e.List.End()
 }
 
-func (e *ElseNode) tree() *Tree {
+func (e *ElseNode) Tree() *Tree {
 	return e.tr
 }
 
@@ -842,29 +725,20 @@ type BranchNode struct {
 	Pipe  *PipeNode   // The pipeline to be evaluated.
 	List  *ListNode   // What to execute if the value is non-empty.
 	Elses []*ElseNode // all else / else if lists
-	End   *EndNode
-	Trim  trim
+	Close *EndNode    // The closing {{end}}.
+	Trim  Trim
 }
 
 func (b *BranchNode) String() string {
 	sb := newPrinter()
-	b.writeTo(sb)
+	sb.print(b)
 	return sb.String()
 }
 
-func (b *BranchNode) writeTo(sb *printer) {
-	sb.WriteString(b.Trim.leftDelim())
-	sb.WriteString(b.Keyword)
-	sb.WriteByte(' ')
-	b.Pipe.writeTo(sb)
-	sb.WriteString(b.Trim.rightDelim())
-	b.List.writeTo(sb)
-	for _, e := range b.Elses {
-		e.writeTo(sb)
-	}
-	b.End.writeTo(sb)
+func (b *BranchNode) End() Pos {
+	return b.Close.End()
 }
 
-func (b *BranchNode) tree() *Tree {
+func (b *BranchNode) Tree() *Tree {
 	return b.tr
 }
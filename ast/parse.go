@@ -2,11 +2,20 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Package parse builds parse trees for templates as defined by text/template
-// and html/template. Clients should use those packages to construct templates
-// rather than this one, which provides shared internal data structures not
-// intended for general use.
-package parse
+// Package ast declares the types used to represent syntax trees for
+// templates as defined by text/template and html/template, and parses
+// templates into them.
+//
+// It is derived from text/template/parse, but unlike that package,
+// it keeps enough of the original input to print it back out:
+// trim markers are recorded in each action's Trim,
+// {{ else }} and {{ end }} are represented explicitly by ElseNode and EndNode,
+// and define and block remain part of the tree that contains them.
+//
+// It is also more lax than text/template/parse:
+// it treats all control structures (if, range, with, define, block) identically,
+// and does not check that functions or variables are defined.
+package ast
 
 import (
 	"fmt"
@@ -17,13 +26,16 @@ import (
 
 // Tree is the representation of a single parsed template.
 type Tree struct {
+	Name string    // name of the template file, for error messages.
 	Root *ListNode // top-level root of the tree.
+	Mode Mode      // parsing mode.
 	text string    // text parsed to create the template (or its parent)
 	// Parsing only; cleared after parse.
-	lex        *lexer
-	token      [3]item // three-token lookahead for parser.
-	peekCount  int
-	actionLine int // line of left delim starting action
+	lex         *lexer
+	token       [3]item // three-token lookahead for parser.
+	peekCount   int
+	actionLine  int // line of left delim starting action
+	actionStart Pos // position of left delim starting action
 }
 
 // A mode value is a set of flags (or 0). Modes control parser behavior.
@@ -31,15 +43,13 @@ type Mode uint
 
 const (
 	ParseComments Mode = 1 << iota // parse comments and add them to AST
-	SkipFuncCheck                  // do not check that functions are defined
+	SkipFuncCheck                  // do not check that functions are defined; always true here
 )
 
-// Parse returns a map from template name to parse.Tree, created by parsing the
-// templates described in the argument string. The top-level template will be
-// given the specified name. If an error is encountered, parsing stops and an
-// empty map is returned with the error.
+// Parse parses text and returns the root of the resulting tree.
+// It is shorthand for ParseFile("", text) followed by reading the Root.
 func Parse(text string) (Node, error) {
-	t := new(Tree)
+	t := &Tree{Mode: ParseComments}
 	err := t.Parse(text)
 	if err != nil {
 		return nil, err
@@ -47,6 +57,24 @@ func Parse(text string) (Node, error) {
 	return t.Root, nil
 }
 
+// ParseFile parses the template source src and returns the resulting Tree.
+// name is used in error messages, and may be empty.
+// Comments are kept, as if by the ParseComments mode;
+// to discard them, use a Tree's Parse method.
+func ParseFile(name, src string) (*Tree, error) {
+	t := &Tree{Name: name, Mode: ParseComments}
+	err := t.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Source returns the text from which t was parsed.
+func (t *Tree) Source() string {
+	return t.text
+}
+
 // next returns the next token.
 func (t *Tree) next() item {
 	if t.peekCount > 0 {
@@ -112,7 +140,7 @@ func (t *Tree) peekNonSpace() item {
 // which can occur in old code.
 func (t *Tree) ErrorContext(n Node) (location, context string) {
 	pos := int(n.Position())
-	tree := n.tree()
+	tree := n.Tree()
 	if tree == nil {
 		tree = t
 	}
@@ -132,10 +160,19 @@ func (t *Tree) ErrorContext(n Node) (location, context string) {
 // errorf formats the error and terminates processing.
 func (t *Tree) errorf(format string, args ...any) {
 	t.Root = nil
-	format = fmt.Sprintf("template: %d: %s", t.token[0].line, format)
+	format = fmt.Sprintf("template: %s%d: %s", t.namePrefix(), t.token[0].line, format)
 	panic(fmt.Errorf(format, args...))
 }
 
+// namePrefix returns the template name followed by a colon,
+// for use in error messages, or "" if the template has no name.
+func (t *Tree) namePrefix() string {
+	if t.Name == "" {
+		return ""
+	}
+	return t.Name + ":"
+}
+
 // error terminates processing.
 func (t *Tree) error(err error) {
 	t.errorf("%s", err)
@@ -167,6 +204,9 @@ func (t *Tree) unexpected(token item, context string) {
 
 // Parse parses the template definition string to construct a representation of
 // the template for formatting.
+// Unless t.Mode includes ParseComments, comments are discarded,
+// and the text around them is trimmed as their trim markers require,
+// so the tree renders the same as the template.
 func (t *Tree) Parse(text string) (err error) {
 	defer func() {
 		e := recover()
@@ -181,9 +221,51 @@ func (t *Tree) Parse(text string) (err error) {
 	t.lex = lex(text)
 	t.text = text
 	t.parse()
+	if t.Mode&ParseComments == 0 {
+		stripComments(t.Root)
+	}
 	return nil
 }
 
+// stripComments removes the comments from every list in n,
+// trimming the adjacent text as the comments' trim markers would.
+func stripComments(n Node) {
+	Inspect(n, func(n Node) bool {
+		l, ok := n.(*ListNode)
+		if !ok {
+			return true
+		}
+		nodes := l.Nodes[:0]
+		trimNext := false
+		for _, n := range l.Nodes {
+			if c, ok := n.(*CommentNode); ok {
+				if c.Trim.Left && len(nodes) > 0 {
+					if text, ok := nodes[len(nodes)-1].(*TextNode); ok {
+						text.Text = strings.TrimRight(text.Text, spaceChars)
+						if text.Text == "" {
+							nodes = nodes[:len(nodes)-1]
+						}
+					}
+				}
+				trimNext = c.Trim.Right
+				continue
+			}
+			if text, ok := n.(*TextNode); ok && trimNext {
+				trimmed := strings.TrimLeft(text.Text, spaceChars)
+				text.Pos += Pos(len(text.Text) - len(trimmed))
+				text.Text = trimmed
+				if text.Text == "" {
+					continue
+				}
+			}
+			trimNext = false
+			nodes = append(nodes, n)
+		}
+		l.Nodes = nodes
+		return true
+	})
+}
+
 // parse is the top-level parser for a template, essentially the same
 // as itemList except it also parses {{define}} actions.
 // It runs to EOF.
@@ -196,12 +278,13 @@ func (t *Tree) parse() {
 			t.backup2(delim)
 		}
 		switch n := t.textOrAction(); n.Type() {
-		case nodeEnd, nodeElse:
+		case NodeEnd, NodeElse:
 			t.errorf("unexpected %s", n)
 		default:
 			t.Root.append(n)
 		}
 	}
+	t.Root.end = Pos(len(t.text))
 }
 
 // itemList:
@@ -214,9 +297,16 @@ func (t *Tree) itemList() (list *ListNode, next Node) {
 	for t.peekNonSpace().typ != itemEOF {
 		n := t.textOrAction()
 		switch n.Type() {
-		case nodeEnd, nodeElse:
+		case NodeEnd, NodeElse:
+			list.end = t.actionStart
+			if len(list.Nodes) == 0 {
+				list.Pos = list.end
+			}
 			return list, n
 		}
+		if len(list.Nodes) == 0 {
+			list.Pos = n.Position()
+		}
 		list.append(n)
 	}
 	t.errorf("unexpected EOF")
@@ -233,10 +323,14 @@ func (t *Tree) textOrAction() (n Node) {
 		return t.newText(token.pos, token.val)
 	case itemLeftDelim:
 		t.actionLine = token.line
+		t.actionStart = token.pos
 		defer t.clearActionLine()
 		return t.action(token.trim)
 	case itemComment:
-		return t.newComment(token.pos, token.val)
+		// The comment token holds only /* ... */; extend it to the delimiters.
+		start := Pos(strings.LastIndex(t.text[:token.pos], leftDelim))
+		end := token.end() + Pos(strings.Index(t.text[token.end():], rightDelim)+len(rightDelim))
+		return t.newComment(start, end, token.val, token.trim)
 	default:
 		t.unexpected(token, "input")
 	}
@@ -254,20 +348,21 @@ func (t *Tree) clearActionLine() {
 //
 // Left delim is past. Now get actions.
 // First word could be a keyword such as range.
-func (t *Tree) action(trim trim) (n Node) {
+func (t *Tree) action(trim Trim) (n Node) {
+	start := t.actionStart
 	switch token := t.nextNonSpace(); token.typ {
 	case itemElse:
-		return t.elseControl(trim)
+		return t.elseControl(start, trim)
 	case itemEnd:
-		return t.endControl(trim)
+		return t.endControl(start, trim)
 	case itemIf, itemBranch:
-		return t.branchControl(token.val, trim)
+		return t.branchControl(token.val, start, trim)
 	}
 	t.backup()
 	token := t.peek()
 	pipe, endtok := t.pipeline("command", itemRightDelim)
-	trim.right = endtok.trim.right
-	return t.newAction(token.pos, token.line, pipe, trim)
+	trim.Right = endtok.trim.Right
+	return t.newAction(start, endtok.end(), token.line, pipe, trim)
 }
 
 // Pipeline:
@@ -315,6 +410,7 @@ decls:
 		case end:
 			// At this point, the pipeline is complete
 			t.checkPipeline(pipe, context)
+			pipe.end = pipe.Cmds[len(pipe.Cmds)-1].End()
 			return pipe, token
 		case itemBool, itemCharConstant, itemComplex, itemDot, itemField, itemIdentifier,
 			itemNumber, itemNil, itemRawString, itemString, itemVariable, itemLeftParen:
@@ -347,16 +443,17 @@ func (t *Tree) checkPipeline(pipe *PipeNode, context string) {
 //	{{if pipeline}} itemList {{else}} itemList {{end}}
 //
 // If keyword is past.
-func (t *Tree) branchControl(keyword string, trim trim) Node {
+func (t *Tree) branchControl(keyword string, start Pos, trim Trim) Node {
 	pipe, tok := t.pipeline(keyword, itemRightDelim)
-	trim.right = tok.trim.right
+	trim.Right = tok.trim.Right
 	b := &BranchNode{
-		tr:      t,
-		Keyword: keyword,
-		Pos:     pipe.Position(),
-		Line:    pipe.Line,
-		Pipe:    pipe,
-		Trim:    trim,
+		tr:       t,
+		NodeType: NodeBranch,
+		Keyword:  keyword,
+		Pos:      start,
+		Line:     pipe.Line,
+		Pipe:     pipe,
+		Trim:     trim,
 	}
 	var next Node
 	b.List, next = t.itemList() // TODO: use next
@@ -367,7 +464,7 @@ Elses:
 			n.List, next = t.itemList()
 			b.Elses = append(b.Elses, n)
 		case *EndNode:
-			b.End = n
+			b.Close = n
 			break Elses
 		}
 	}
@@ -379,10 +476,10 @@ Elses:
 //	{{end}}
 //
 // End keyword is past.
-func (t *Tree) endControl(trim trim) Node {
+func (t *Tree) endControl(start Pos, trim Trim) Node {
 	token := t.expect(itemRightDelim, "end")
-	trim.right = token.trim.right
-	return t.newEnd(token.pos, trim)
+	trim.Right = token.trim.Right
+	return t.newEnd(start, token.end(), trim)
 }
 
 // Else:
@@ -390,7 +487,7 @@ func (t *Tree) endControl(trim trim) Node {
 //	{{else}}
 //
 // Else keyword is past.
-func (t *Tree) elseControl(trim trim) Node {
+func (t *Tree) elseControl(start Pos, trim Trim) Node {
 	var token item
 	var pipe *PipeNode
 	peek := t.peekNonSpace()
@@ -398,12 +495,12 @@ func (t *Tree) elseControl(trim trim) Node {
 		token = t.next() // Consume the "if" token.
 		var eoptok item
 		pipe, eoptok = t.pipeline("else if", itemRightDelim)
-		trim.right = eoptok.trim.right
+		trim.Right = eoptok.trim.Right
 	} else {
 		token = t.expect(itemRightDelim, "else")
-		trim.right = token.trim.right
+		trim.Right = token.trim.Right
 	}
-	return t.newElse(token.pos, token.line, pipe, trim)
+	return t.newElse(start, token.line, pipe, trim)
 }
 
 // command:
@@ -451,7 +548,7 @@ func (t *Tree) operand() Node {
 		return nil
 	}
 	if t.peek().typ == itemField {
-		chain := t.newChain(t.peek().pos, node)
+		chain := t.newChain(node.Position(), node)
 		for t.peek().typ == itemField {
 			chain.Add(t.next().val)
 		}
@@ -506,7 +603,10 @@ func (t *Tree) term() Node {
 		}
 		return number
 	case itemLeftParen:
-		pipe, _ := t.pipeline("parenthesized pipeline", itemRightParen)
+		pipe, endtok := t.pipeline("parenthesized pipeline", itemRightParen)
+		// Include the parentheses in the pipeline's extent.
+		pipe.Pos = token.pos
+		pipe.end = endtok.end()
 		return pipe
 	case itemString, itemRawString:
 		s, err := strconv.Unquote(token.val)
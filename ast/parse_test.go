@@ -0,0 +1,122 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseFile(t *testing.T) {
+	const src = "<p>{{- .A }}</p>"
+	tree, err := ParseFile("a.tmpl", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Source() != src {
+		t.Errorf("Source() = %q, want %q", tree.Source(), src)
+	}
+	action := tree.Root.Nodes[1].(*ActionNode)
+	if action.Tree() != tree {
+		t.Errorf("action.Tree() = %p, want %p", action.Tree(), tree)
+	}
+	if want := (Trim{Left: true}); action.Trim != want {
+		t.Errorf("action.Trim = %+v, want %+v", action.Trim, want)
+	}
+
+	_, err = ParseFile("b.tmpl", "\n{{ if }}")
+	if err == nil || !strings.HasPrefix(err.Error(), "template: b.tmpl:2: ") {
+		t.Errorf("ParseFile error = %v, want prefix template: b.tmpl:2:", err)
+	}
+}
+
+func TestSpans(t *testing.T) {
+	const src = "x{{- if $x := .A.B -}}\n{{/* c */ -}}{{ else if eq (f .B).C 1.5 }}{{ $x.D | printf \"%s\" `y` }}{{ else }}{{ nil }}{{ true }}{{ end }}"
+	root, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	Inspect(root, func(n Node) bool {
+		if n != nil {
+			got = append(got, fmt.Sprintf("%T %s", n, src[n.Position():n.End()]))
+		}
+		return true
+	})
+	want := []string{
+		"*ast.ListNode " + src,
+		"*ast.TextNode x",
+		"*ast.BranchNode " + src[1:],
+		"*ast.PipeNode $x := .A.B",
+		"*ast.VariableNode $x",
+		"*ast.CommandNode .A.B",
+		"*ast.FieldNode .A.B",
+		"*ast.ListNode \n{{/* c */ -}}",
+		"*ast.TextNode \n",
+		"*ast.CommentNode {{/* c */ -}}",
+		"*ast.ElseNode {{ else if eq (f .B).C 1.5 }}{{ $x.D | printf \"%s\" `y` }}",
+		"*ast.PipeNode eq (f .B).C 1.5",
+		"*ast.CommandNode eq (f .B).C 1.5",
+		"*ast.IdentifierNode eq",
+		"*ast.ChainNode (f .B).C",
+		"*ast.PipeNode (f .B)",
+		"*ast.CommandNode f .B",
+		"*ast.IdentifierNode f",
+		"*ast.FieldNode .B",
+		"*ast.NumberNode 1.5",
+		"*ast.ListNode {{ $x.D | printf \"%s\" `y` }}",
+		"*ast.ActionNode {{ $x.D | printf \"%s\" `y` }}",
+		"*ast.PipeNode $x.D | printf \"%s\" `y`",
+		"*ast.CommandNode $x.D",
+		"*ast.VariableNode $x.D",
+		"*ast.CommandNode printf \"%s\" `y`",
+		"*ast.IdentifierNode printf",
+		"*ast.StringNode \"%s\"",
+		"*ast.StringNode `y`",
+		"*ast.ElseNode {{ else }}{{ nil }}{{ true }}",
+		"*ast.ListNode {{ nil }}{{ true }}",
+		"*ast.ActionNode {{ nil }}",
+		"*ast.PipeNode nil",
+		"*ast.CommandNode nil",
+		"*ast.NilNode nil",
+		"*ast.ActionNode {{ true }}",
+		"*ast.PipeNode true",
+		"*ast.CommandNode true",
+		"*ast.BoolNode true",
+		"*ast.EndNode {{ end }}",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("spans:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	const src = "a {{- /* c */ -}}   b\n\t{{/* own */}}\n{{ .X }} {{/* trail */}}"
+	tree, err := ParseFile("", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	Inspect(tree.Root, func(n Node) bool {
+		if c, ok := n.(*CommentNode); ok {
+			got = append(got, fmt.Sprintf("%s %+v %d", c.Text, c.Trim, c.Placement))
+		}
+		return true
+	})
+	want := []string{
+		"/* c */ {Left:true Right:true} 1",
+		"/* own */ {Left:false Right:false} 0",
+		"/* trail */ {Left:false Right:false} 1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("comments:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Without ParseComments, comments are dropped, honoring their trim markers.
+	stripped := &Tree{}
+	if err := stripped.Parse(src); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stripped.Root.String(), "ab\n\t\n{{ .X }} "; got != want {
+		t.Errorf("stripped = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ast
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// A PrintConfig controls how Sprint lays out a tree.
+type PrintConfig struct {
+	// Indent is the unit of indentation for the continuation lines
+	// of multiline actions. If empty, it is a tab.
+	Indent string
+}
+
+// Sprint returns the formatted text of n.
+func (c PrintConfig) Sprint(n Node) string {
+	sb := newPrinter()
+	if c.Indent != "" {
+		sb.indent = c.Indent
+	}
+	sb.print(n)
+	return sb.String()
+}
+
+// printer accumulates formatted output.
+type printer struct {
+	*strings.Builder
+	prefix string
+	depth  int
+	indent string
+}
+
+func newPrinter() *printer {
+	return &printer{
+		Builder: new(strings.Builder),
+		indent:  "\t",
+	}
+}
+
+func (sb *printer) WritePrefix() {
+	sb.WriteString(sb.prefix)
+	sb.WriteString(strings.Repeat(sb.indent, sb.depth))
+}
+
+// print writes n to sb.
+func (sb *printer) print(n Node) {
+	switch n := n.(type) {
+	case *ListNode:
+		sb.printList(n)
+	case *CommentNode:
+		sb.printComment(n)
+	case *PipeNode:
+		sb.printPipe(n)
+	case *ActionNode:
+		sb.printAction(n)
+	case *CommandNode:
+		sb.printCommand(n)
+	case *VariableNode:
+		sb.printVariable(n)
+	case *FieldNode:
+		sb.printField(n)
+	case *ChainNode:
+		sb.printChain(n)
+	case *EndNode:
+		sb.printEnd(n)
+	case *ElseNode:
+		sb.printElse(n)
+	case *BranchNode:
+		sb.printBranch(n)
+	default:
+		// Leaf nodes print as themselves.
+		sb.WriteString(n.String())
+	}
+}
+
+func (sb *printer) printList(l *ListNode) {
+	if l == nil {
+		return
+	}
+	for i := 0; i < len(l.Nodes); i++ {
+		n := l.Nodes[i]
+		sb.print(n)
+		if !isDirective(n, directiveOff) {
+			continue
+		}
+		// Copy the input verbatim up to the next gotmplfmt:on,
+		// or the end of the list if there is none.
+		start := n.End()
+		end := l.end
+		for i+1 < len(l.Nodes) && !isDirective(l.Nodes[i+1], directiveOn) {
+			i++
+		}
+		if i+1 < len(l.Nodes) {
+			end = l.Nodes[i+1].Position()
+		}
+		sb.WriteString(l.tr.text[start:end])
+	}
+}
+
+func (sb *printer) printComment(c *CommentNode) {
+	sb.WriteString(c.Trim.commentLeftDelim())
+	sb.WriteString(c.Text)
+	sb.WriteString(c.Trim.commentRightDelim())
+}
+
+func (sb *printer) printPipe(p *PipeNode) {
+	if len(p.Decl) > 0 {
+		for i, v := range p.Decl {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.print(v)
+		}
+		if p.IsAssign {
+			sb.WriteString(" = ")
+		} else {
+			sb.WriteString(" := ")
+		}
+	}
+	for i, c := range p.Cmds {
+		if i > 0 {
+			sb.WriteString(" | ")
+		}
+		sb.print(c)
+	}
+}
+
+func (sb *printer) printAction(a *ActionNode) {
+	w, ok := whitespacePrefix(a)
+	sb.prefix = w
+	sb.WriteString(a.Trim.leftDelim())
+	before := strings.Count(sb.String(), "\n")
+	sb.depth = 1
+	sb.print(a.Pipe)
+	sb.depth = 0
+	after := strings.Count(sb.String(), "\n")
+	if ok && before != after {
+		sb.WriteString("\n")
+		sb.WritePrefix()
+		sb.WriteString(a.Trim.rightDelimNoSpace())
+	} else {
+		sb.WriteString(a.Trim.rightDelim())
+	}
+}
+
+// printCommand writes c, keeping its arguments on the lines they started on.
+// An argument that starts a line in the input starts a line in the output,
+// preceded by a blank line if it was in the input, which also ends a run
+// of aligned key/value pairs. Arguments that share a line are separated
+// by a space, padded as alignment requires.
+func (sb *printer) printCommand(c *CommandNode) {
+	if len(c.Args) == 0 {
+		return
+	}
+	// TODO: quadratic!!!
+	lines := make([]int, len(c.Args))
+	for i, arg := range c.Args {
+		lines[i] = lineno(arg)
+	}
+	pad := sb.alignment(c, lines)
+	for i, arg := range c.Args {
+		if i > 0 {
+			if lines[i] > lines[i-1] {
+				if blankLineBefore(arg) {
+					sb.WriteString("\n")
+				}
+				sb.WriteString("\n")
+				sb.WritePrefix()
+			} else {
+				sb.WriteByte(' ')
+				sb.WriteString(strings.Repeat(" ", pad[i]))
+			}
+		}
+		sb.printArg(arg)
+	}
+}
+
+func (sb *printer) printVariable(v *VariableNode) {
+	for i, id := range v.Ident {
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(id)
+	}
+}
+
+func (sb *printer) printField(f *FieldNode) {
+	for _, id := range f.Ident {
+		sb.WriteByte('.')
+		sb.WriteString(id)
+	}
+}
+
+func (sb *printer) printChain(c *ChainNode) {
+	if _, ok := c.Node.(*PipeNode); ok {
+		sb.WriteByte('(')
+		sb.print(c.Node)
+		sb.WriteByte(')')
+	} else {
+		sb.print(c.Node)
+	}
+	for _, field := range c.Field {
+		sb.WriteByte('.')
+		sb.WriteString(field)
+	}
+}
+
+func (sb *printer) printEnd(e *EndNode) {
+	sb.WriteString(e.Trim.leftDelim())
+	sb.WriteString("end")
+	sb.WriteString(e.Trim.rightDelim())
+}
+
+func (sb *printer) printElse(e *ElseNode) {
+	sb.WriteString(e.Trim.leftDelim())
+	sb.WriteString("else")
+	if e.Pipe != nil {
+		sb.WriteString(" if ")
+		sb.print(e.Pipe)
+	}
+	sb.WriteString(e.Trim.rightDelim())
+	sb.print(e.List)
+}
+
+func (sb *printer) printBranch(b *BranchNode) {
+	sb.WriteString(b.Trim.leftDelim())
+	sb.WriteString(b.Keyword)
+	sb.WriteByte(' ')
+	sb.print(b.Pipe)
+	sb.WriteString(b.Trim.rightDelim())
+	sb.print(b.List)
+	for _, e := range b.Elses {
+		sb.print(e)
+	}
+	sb.print(b.Close)
+}
+
+// printArg writes a single command argument to sb,
+// parenthesizing it if it is a pipeline.
+func (sb *printer) printArg(arg Node) {
+	pipe, ok := arg.(*PipeNode)
+	if !ok {
+		sb.print(arg)
+		return
+	}
+	sb.WriteByte('(')
+	before := strings.Count(sb.String(), "\n")
+	sb.depth++
+	sb.print(pipe)
+	sb.depth--
+	after := strings.Count(sb.String(), "\n")
+	if before != after {
+		sb.WriteString("\n")
+		sb.WritePrefix()
+	}
+	sb.WriteByte(')')
+}
+
+// alignment calculates the padding needed to align key/value pairs
+// laid out one per line, as in:
+//
+//	dict
+//		"a"    1
+//		"long" 2
+//
+// lines holds the input line number of each arg.
+// The returned slice holds the number of extra spaces to write before each arg.
+// As with gofmt, alignment sections are broken by blank lines
+// and by lines that are not a single-line key/value pair.
+func (sb *printer) alignment(c *CommandNode, lines []int) []int {
+	pad := make([]int, len(c.Args))
+	var section []int // indices of the keys in the current section
+	var width int     // widest key in the current section
+	flush := func() {
+		if len(section) > 1 {
+			for _, k := range section {
+				pad[k+1] = width - sb.argWidth(c.Args[k])
+			}
+		}
+		section = section[:0]
+		width = 0
+	}
+	// Skip the first line, which holds the command name.
+	i := 1
+	for i < len(c.Args) && lines[i] == lines[0] {
+		i++
+	}
+	for i < len(c.Args) {
+		j := i + 1
+		for j < len(c.Args) && lines[j] == lines[i] {
+			j++
+		}
+		if blankLineBefore(c.Args[i]) {
+			flush()
+		}
+		if j-i != 2 || sb.argWidth(c.Args[i]) < 0 || sb.argWidth(c.Args[i+1]) < 0 {
+			flush()
+			i = j
+			continue
+		}
+		section = append(section, i)
+		if w := sb.argWidth(c.Args[i]); w > width {
+			width = w
+		}
+		i = j
+	}
+	flush()
+	return pad
+}
+
+// argWidth returns the width of arg when written to sb.
+// It returns -1 if arg would span multiple lines.
+func (sb *printer) argWidth(arg Node) int {
+	scratch := newPrinter()
+	scratch.prefix = sb.prefix
+	scratch.depth = sb.depth
+	scratch.indent = sb.indent
+	scratch.printArg(arg)
+	s := scratch.String()
+	if strings.Contains(s, "\n") {
+		return -1
+	}
+	return utf8.RuneCountInString(s)
+}
+
+func lineno(n Node) int {
+	// TODO: common uses will be quadratic!
+	// it would be easy to put in place a simple lookup structure instead at some point
+	return strings.Count(n.Tree().text[:n.Position()], "\n")
+}
+
+// blankLineBefore reports whether n is preceded by a blank line,
+// that is, whether the whitespace immediately before n contains at least two newlines.
+func blankLineBefore(n Node) bool {
+	txt := n.Tree().text[:n.Position()]
+	space := txt[len(strings.TrimRight(txt, spaceChars)):]
+	return strings.Count(space, "\n") > 1
+}
+
+// whitespacePrefix returns the exact whitespace from the beginning of n's line to n.
+// If there is any non-whitespace, it returns "", false.
+// For example, for a line that begins "\t\t{{ " it will return "\t\t", true,
+// but "\tx\t{{ " will yield "", false.
+func whitespacePrefix(n Node) (string, bool) {
+	txt := n.Tree().text
+	pos := n.Position()
+	start := strings.LastIndex(txt[:pos], "\n") // -1 on the first line
+	line := txt[start+1 : pos]
+	w := int(leftTrimLength(line)) // length of whitespace
+	if w != len(line) {
+		return "", false
+	}
+	return line, true
+}
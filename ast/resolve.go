@@ -0,0 +1,146 @@
+package ast
+
+// A Resolution records the variable declarations found by Resolve.
+type Resolution struct {
+	// Decls maps each variable reference, including the targets of = assignments,
+	// to the VariableNode that declares it, in a := declaration
+	// or in the pipeline of a control structure such as range.
+	// The predeclared variable $ has no declaration,
+	// so references to it do not appear.
+	Decls map[*VariableNode]*VariableNode
+	// Undeclared holds the references to variables that are not declared,
+	// in the order in which they appear.
+	Undeclared []*VariableNode
+	// Shadows maps each declaration that hides a variable
+	// declared in an enclosing scope to the hidden declaration.
+	Shadows map[*VariableNode]*VariableNode
+}
+
+// Resolve links the variable references in the template rooted at n
+// to their declarations, following the scoping rules of text/template:
+//
+//   - A variable declared in an action is visible until the end
+//     of the enclosing control structure, or of the template.
+//   - A variable declared in the pipeline of if, with, or range is visible
+//     in its body and its else branches, including a chained else if.
+//   - The bodies of define and block start afresh,
+//     seeing only $ and their own variables.
+//
+// The parser, unlike text/template's, does not track variables,
+// so Resolve is how to find undeclared variables.
+func Resolve(n Node) *Resolution {
+	r := &resolver{res: &Resolution{
+		Decls:   make(map[*VariableNode]*VariableNode),
+		Shadows: make(map[*VariableNode]*VariableNode),
+	}}
+	r.node(n, new(scope))
+	return r.res
+}
+
+// A scope holds the variables declared in a control structure or template.
+type scope struct {
+	parent *scope
+	vars   []*VariableNode // in order of declaration
+}
+
+// lookup returns the innermost declaration of name visible in s, or nil.
+func (s *scope) lookup(name string) *VariableNode {
+	for ; s != nil; s = s.parent {
+		for i := len(s.vars) - 1; i >= 0; i-- {
+			if s.vars[i].Ident[0] == name {
+				return s.vars[i]
+			}
+		}
+	}
+	return nil
+}
+
+type resolver struct {
+	res *Resolution
+}
+
+func (r *resolver) node(n Node, s *scope) {
+	switch n := n.(type) {
+	case *ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			r.node(c, s)
+		}
+	case *ActionNode:
+		r.pipe(n.Pipe, s)
+	case *BranchNode:
+		r.branch(n, s)
+	case *ElseNode:
+		// An else outside its branch, as when resolving a subtree.
+		r.pipe(n.Pipe, s)
+		r.node(n.List, &scope{parent: s})
+	case *PipeNode:
+		r.pipe(n, s)
+	}
+}
+
+func (r *resolver) branch(b *BranchNode, s *scope) {
+	if b.Keyword == "define" || b.Keyword == "block" {
+		if b.Keyword == "block" {
+			r.pipe(b.Pipe, s)
+		}
+		r.node(b.List, new(scope))
+		return
+	}
+	cur := &scope{parent: s}
+	r.pipe(b.Pipe, cur)
+	r.node(b.List, &scope{parent: cur})
+	for _, e := range b.Elses {
+		if e.Pipe != nil {
+			cur = &scope{parent: cur}
+			r.pipe(e.Pipe, cur)
+		}
+		r.node(e.List, &scope{parent: cur})
+	}
+}
+
+// pipe resolves the references in p and then declares p's variables in s.
+func (r *resolver) pipe(p *PipeNode, s *scope) {
+	if p == nil {
+		return
+	}
+	for _, cmd := range p.Cmds {
+		for _, arg := range cmd.Args {
+			r.arg(arg, s)
+		}
+	}
+	for _, v := range p.Decl {
+		if p.IsAssign {
+			r.ref(v, s)
+			continue
+		}
+		if prev := s.parent.lookup(v.Ident[0]); prev != nil && s.lookup(v.Ident[0]) == prev {
+			r.res.Shadows[v] = prev
+		}
+		s.vars = append(s.vars, v)
+	}
+}
+
+func (r *resolver) arg(arg Node, s *scope) {
+	switch arg := arg.(type) {
+	case *VariableNode:
+		r.ref(arg, s)
+	case *PipeNode:
+		r.pipe(arg, s)
+	case *ChainNode:
+		r.arg(arg.Node, s)
+	}
+}
+
+func (r *resolver) ref(v *VariableNode, s *scope) {
+	if v.Ident[0] == "$" {
+		return
+	}
+	if decl := s.lookup(v.Ident[0]); decl != nil {
+		r.res.Decls[v] = decl
+		return
+	}
+	r.res.Undeclared = append(r.res.Undeclared, v)
+}
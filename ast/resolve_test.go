@@ -0,0 +1,61 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		src        string
+		decls      []string // reference@offset -> declaration@offset
+		undeclared []string
+		shadows    []string
+	}{
+		{
+			src:   `{{ $x := 1 }}{{ $x }}{{ $x = 2 }}{{ $.A }}`,
+			decls: []string{"$x@16 -> $x@3", "$x@24 -> $x@3"},
+		},
+		{
+			src:        `{{ if $x := .A }}{{ $y := $x }}{{ else if $z := .B }}{{ $x }}{{ $z }}{{ $y }}{{ end }}{{ $x }}`,
+			decls:      []string{"$x@26 -> $x@6", "$x@56 -> $x@6", "$z@64 -> $z@42"},
+			undeclared: []string{"$y@72", "$x@89"},
+		},
+		{
+			src:        `{{ range $i, $e := . }}{{ $e := $i }}{{ end }}{{ define "t" }}{{ $e }}{{ $i := 1 }}{{ end }}`,
+			decls:      []string{"$i@32 -> $i@9"},
+			undeclared: []string{"$e@65"},
+			shadows:    []string{"$e@26 -> $e@13"},
+		},
+		{
+			src:     `{{ $x := 1 }}{{ with $x := ($y := $x) }}{{ $y }}{{ end }}`,
+			decls:   []string{"$x@34 -> $x@3", "$y@43 -> $y@28"},
+			shadows: []string{"$x@21 -> $x@3"},
+		},
+	}
+	for _, tt := range tests {
+		root, err := Parse(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := Resolve(root)
+		var decls, undeclared, shadows []string
+		for ref, decl := range res.Decls {
+			decls = append(decls, fmt.Sprintf("%s@%d -> %s@%d", ref, ref.Position(), decl, decl.Position()))
+		}
+		for _, ref := range res.Undeclared {
+			undeclared = append(undeclared, fmt.Sprintf("%s@%d", ref, ref.Position()))
+		}
+		for decl, prev := range res.Shadows {
+			shadows = append(shadows, fmt.Sprintf("%s@%d -> %s@%d", decl, decl.Position(), prev, prev.Position()))
+		}
+		sort.Strings(decls)
+		sort.Strings(shadows)
+		if !reflect.DeepEqual(decls, tt.decls) || !reflect.DeepEqual(undeclared, tt.undeclared) || !reflect.DeepEqual(shadows, tt.shadows) {
+			t.Errorf("Resolve(%q):\ndecls %q, want %q\nundeclared %q, want %q\nshadows %q, want %q",
+				tt.src, decls, tt.decls, undeclared, tt.undeclared, shadows, tt.shadows)
+		}
+	}
+}
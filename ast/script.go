@@ -0,0 +1,431 @@
+package ast
+
+import "strings"
+
+// IndentScripts re-indents the bodies of <script> and <style> elements in n
+// relative to their start tags, using indent as the unit of indentation.
+// The least indented lines of a body are indented one unit deeper than
+// the line holding the start tag, other lines keep their indentation
+// relative to those, and an end tag on its own line lines up with the start tag.
+//
+// Only whitespace at the start of lines changes, but that whitespace
+// is text, so the template renders it differently.
+// Actions inside a body are opaque, and lines that begin inside
+// a string, template, or regular expression literal are left alone.
+// Scripts whose type is neither JavaScript nor JSON, start tags that
+// do not begin their line, and gotmplfmt:off regions are left alone.
+func IndentScripts(n Node, indent string) {
+	var texts []*TextNode
+	Inspect(n, func(n Node) bool {
+		if t, ok := n.(*TextNode); ok {
+			texts = append(texts, t)
+		}
+		return true
+	})
+	s := &scriptScanner{indent: indent, off: offRegions(n)}
+	for i, t := range texts {
+		if i > 0 && texts[i-1].End() < t.Position() {
+			s.opaque()
+		}
+		for j := 0; j < len(t.Text); {
+			j = s.step(t, j)
+		}
+	}
+	// Apply the edits back to front, so that earlier offsets remain valid.
+	for i := len(s.edits) - 1; i >= 0; i-- {
+		e := s.edits[i]
+		e.text.Text = e.text.Text[:e.start] + e.repl + e.text.Text[e.end:]
+	}
+}
+
+type scriptMode int
+
+const (
+	scriptHTML        scriptMode = iota // outside any script or style element
+	scriptHTMLComment                   // inside <!-- -->
+	scriptTag                           // inside a <script> or <style> start tag
+	scriptBody                          // inside a script or style body
+)
+
+// scriptState is the lexical state of a script or style body.
+type scriptState int
+
+const (
+	stateCode scriptState = iota
+	stateLineComment
+	stateBlockComment
+	stateSingleQuote
+	stateDoubleQuote
+	stateTemplate // JS template literal
+	stateRegexp
+	stateRegexpClass
+)
+
+// scriptLine is a line in a script or style body whose indentation may change.
+type scriptLine struct {
+	text       *TextNode
+	start, end int  // extent of the leading whitespace in text.Text
+	closing    bool // the line begins with the end tag
+}
+
+// scriptEdit replaces text.Text[start:end] with repl.
+type scriptEdit struct {
+	text       *TextNode
+	start, end int
+	repl       string
+}
+
+// scriptScanner finds and re-indents script and style bodies in a sequence of text nodes.
+type scriptScanner struct {
+	indent string
+	off    [][2]Pos
+	edits  []scriptEdit
+
+	mode      scriptMode
+	tag       string // "script" or "style"
+	tagIndent string // indentation of the line holding the start tag
+	indentOK  bool   // the start tag begins its line
+	attrs     strings.Builder
+	attrQuote byte
+	skip      bool // the body is not JavaScript, JSON, or CSS
+	lines     []scriptLine
+
+	state     scriptState
+	tmplDepth []int  // brace depth within each enclosing ${ } of a template literal
+	lastSig   byte   // last significant byte of code, for telling regexps from division
+	lastWord  string // last identifier or keyword of code
+}
+
+// opaque records an action between two text nodes.
+func (s *scriptScanner) opaque() {
+	switch s.mode {
+	case scriptTag:
+		// A dynamic attribute might be a type.
+		s.attrs.WriteString("{{}}")
+	case scriptBody:
+		if s.state == stateCode {
+			// An action in code is a value.
+			s.lastSig, s.lastWord = 'a', ""
+		}
+	}
+}
+
+// step scans t.Text starting at j and returns the offset at which to continue.
+func (s *scriptScanner) step(t *TextNode, j int) int {
+	rest := t.Text[j:]
+	switch s.mode {
+	case scriptHTMLComment:
+		if strings.HasPrefix(rest, "-->") {
+			s.mode = scriptHTML
+			return j + len("-->")
+		}
+		return j + 1
+	case scriptHTML:
+		if strings.HasPrefix(rest, "<!--") {
+			s.mode = scriptHTMLComment
+			return j + len("<!--")
+		}
+		for _, tag := range []string{"script", "style"} {
+			if hasTag(rest, "<"+tag) {
+				s.startTag(t, j, tag)
+				return j + len("<") + len(tag)
+			}
+		}
+		return j + 1
+	case scriptTag:
+		c := rest[0]
+		switch {
+		case s.attrQuote != 0:
+			if c == s.attrQuote {
+				s.attrQuote = 0
+			}
+		case c == '"' || c == '\'':
+			s.attrQuote = c
+		case c == '>':
+			s.mode = scriptBody
+			s.skip = s.tag == "script" && !isScriptType(s.attrs.String())
+			return j + 1
+		}
+		s.attrs.WriteByte(c)
+		return j + 1
+	}
+
+	// scriptBody
+	if hasTag(rest, "</"+s.tag) {
+		s.finish()
+		s.mode = scriptHTML
+		return j + len("</") + len(s.tag)
+	}
+	if rest[0] == '\n' {
+		s.newline(t, j+1)
+		return j + 1
+	}
+	if s.skip {
+		return j + 1
+	}
+	if s.tag == "style" {
+		return s.stepCSS(rest, j)
+	}
+	return s.stepJS(rest, j)
+}
+
+// startTag begins a <script> or <style> element whose start tag is at t.Text[j:].
+func (s *scriptScanner) startTag(t *TextNode, j int, tag string) {
+	s.mode = scriptTag
+	s.tag = tag
+	s.attrs.Reset()
+	s.attrQuote = 0
+	s.lines = s.lines[:0]
+	s.state = stateCode
+	s.tmplDepth = s.tmplDepth[:0]
+	s.lastSig, s.lastWord = 0, ""
+	nl := strings.LastIndex(t.Text[:j], "\n")
+	s.tagIndent = t.Text[nl+1 : j]
+	s.indentOK = (nl >= 0 || t.Position() == 0) && strings.Trim(s.tagIndent, " \t") == ""
+}
+
+// newline records the line that begins at t.Text[j:].
+func (s *scriptScanner) newline(t *TextNode, j int) {
+	switch s.state {
+	case stateLineComment, stateSingleQuote, stateDoubleQuote, stateRegexp, stateRegexpClass:
+		// None of these continue past an unescaped newline.
+		s.state = stateCode
+	case stateTemplate:
+		return
+	}
+	pos := t.Position() + Pos(j)
+	for _, r := range s.off {
+		if r[0] <= pos && pos < r[1] {
+			return
+		}
+	}
+	k := j
+	for k < len(t.Text) && (t.Text[k] == ' ' || t.Text[k] == '\t') {
+		k++
+	}
+	if k < len(t.Text) && (t.Text[k] == '\n' || t.Text[k] == '\r') {
+		// Leave blank lines alone.
+		return
+	}
+	s.lines = append(s.lines, scriptLine{text: t, start: j, end: k, closing: hasTag(t.Text[k:], "</"+s.tag)})
+}
+
+// finish re-indents the lines of the body that just ended.
+func (s *scriptScanner) finish() {
+	if !s.indentOK || s.skip {
+		return
+	}
+	common := ""
+	first := true
+	for _, l := range s.lines {
+		if l.closing {
+			continue
+		}
+		ws := l.text.Text[l.start:l.end]
+		if first {
+			common, first = ws, false
+			continue
+		}
+		i := 0
+		for i < len(common) && i < len(ws) && common[i] == ws[i] {
+			i++
+		}
+		common = common[:i]
+	}
+	for _, l := range s.lines {
+		ws := l.text.Text[l.start:l.end]
+		repl := s.tagIndent
+		if !l.closing {
+			repl += s.indent + ws[len(common):]
+		}
+		if repl != ws {
+			s.edits = append(s.edits, scriptEdit{text: l.text, start: l.start, end: l.end, repl: repl})
+		}
+	}
+}
+
+// stepJS scans JavaScript at rest, which is at offset j of its text node.
+func (s *scriptScanner) stepJS(rest string, j int) int {
+	c := rest[0]
+	switch s.state {
+	case stateLineComment:
+		return j + 1
+	case stateBlockComment:
+		if strings.HasPrefix(rest, "*/") {
+			s.state = stateCode
+			return j + 2
+		}
+		return j + 1
+	case stateSingleQuote, stateDoubleQuote:
+		switch {
+		case c == '\\':
+			return j + 2
+		case c == '\'' && s.state == stateSingleQuote, c == '"' && s.state == stateDoubleQuote:
+			s.state = stateCode
+			s.lastSig, s.lastWord = 'a', ""
+		}
+		return j + 1
+	case stateTemplate:
+		switch {
+		case c == '\\':
+			return j + 2
+		case c == '`':
+			s.state = stateCode
+			s.lastSig, s.lastWord = 'a', ""
+		case strings.HasPrefix(rest, "${"):
+			s.state = stateCode
+			s.tmplDepth = append(s.tmplDepth, 0)
+			s.lastSig, s.lastWord = '(', ""
+			return j + 2
+		}
+		return j + 1
+	case stateRegexp:
+		switch c {
+		case '\\':
+			return j + 2
+		case '[':
+			s.state = stateRegexpClass
+		case '/':
+			s.state = stateCode
+			s.lastSig, s.lastWord = 'a', ""
+		}
+		return j + 1
+	case stateRegexpClass:
+		switch c {
+		case '\\':
+			return j + 2
+		case ']':
+			s.state = stateRegexp
+		}
+		return j + 1
+	}
+
+	// stateCode
+	switch c {
+	case '/':
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			s.state = stateLineComment
+			return j + 2
+		case strings.HasPrefix(rest, "/*"):
+			s.state = stateBlockComment
+			return j + 2
+		case s.regexpAllowed():
+			s.state = stateRegexp
+			return j + 1
+		}
+	case '\'':
+		s.state = stateSingleQuote
+		return j + 1
+	case '"':
+		s.state = stateDoubleQuote
+		return j + 1
+	case '`':
+		s.state = stateTemplate
+		return j + 1
+	case '{':
+		if n := len(s.tmplDepth); n > 0 {
+			s.tmplDepth[n-1]++
+		}
+	case '}':
+		if n := len(s.tmplDepth); n > 0 {
+			if s.tmplDepth[n-1] == 0 {
+				s.tmplDepth = s.tmplDepth[:n-1]
+				s.state = stateTemplate
+				return j + 1
+			}
+			s.tmplDepth[n-1]--
+		}
+	case ' ', '\t', '\r', '\n':
+		return j + 1
+	}
+	if isIdentByte(c) {
+		if !isIdentByte(s.lastSig) {
+			s.lastWord = ""
+		}
+		s.lastWord += string(c)
+	}
+	s.lastSig = c
+	return j + 1
+}
+
+// regexpAllowed reports whether a / in code begins a regular expression literal,
+// rather than being a division operator, judging by the code before it.
+func (s *scriptScanner) regexpAllowed() bool {
+	if s.lastSig == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", s.lastSig) >= 0 {
+		return true
+	}
+	switch s.lastWord {
+	case "return", "typeof", "case", "do", "else", "in", "instanceof", "new", "delete", "void", "throw", "yield", "await":
+		return isIdentByte(s.lastSig)
+	}
+	return false
+}
+
+// stepCSS scans CSS at rest, which is at offset j of its text node.
+func (s *scriptScanner) stepCSS(rest string, j int) int {
+	c := rest[0]
+	switch s.state {
+	case stateBlockComment:
+		if strings.HasPrefix(rest, "*/") {
+			s.state = stateCode
+			return j + 2
+		}
+	case stateSingleQuote, stateDoubleQuote:
+		switch {
+		case c == '\\':
+			return j + 2
+		case c == '\'' && s.state == stateSingleQuote, c == '"' && s.state == stateDoubleQuote:
+			s.state = stateCode
+		}
+	default:
+		switch {
+		case strings.HasPrefix(rest, "/*"):
+			s.state = stateBlockComment
+			return j + 2
+		case c == '\'':
+			s.state = stateSingleQuote
+		case c == '"':
+			s.state = stateDoubleQuote
+		}
+	}
+	return j + 1
+}
+
+// hasTag reports whether s begins with tag, case-insensitively,
+// followed by the end of the tag name.
+func hasTag(s, tag string) bool {
+	if len(s) < len(tag) || !strings.EqualFold(s[:len(tag)], tag) {
+		return false
+	}
+	if len(s) == len(tag) {
+		return true
+	}
+	return strings.IndexByte(" \t\r\n\f/>", s[len(tag)]) >= 0
+}
+
+// isScriptType reports whether a script with the start tag attributes attrs
+// holds JavaScript or JSON, in which indentation is insignificant.
+func isScriptType(attrs string) bool {
+	i := strings.Index(strings.ToLower(attrs), "type=")
+	if i < 0 {
+		return true
+	}
+	typ := attrs[i+len("type="):]
+	if typ != "" && (typ[0] == '"' || typ[0] == '\'') {
+		if end := strings.IndexByte(typ[1:], typ[0]); end >= 0 {
+			typ = typ[1 : 1+end]
+		}
+	} else if end := strings.IndexAny(typ, " \t\r\n\f"); end >= 0 {
+		typ = typ[:end]
+	}
+	switch strings.ToLower(strings.TrimSpace(typ)) {
+	case "", "module", "text/javascript", "application/javascript", "application/json", "application/ld+json":
+		return true
+	}
+	return false
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
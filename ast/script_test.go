@@ -0,0 +1,79 @@
+package ast
+
+import "testing"
+
+func TestIndentScripts(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "script",
+			in:   "<div>\n  <script>\nif (x) {\n    f({{ .A }});\n}\n      </script>\n</div>",
+			want: "<div>\n  <script>\n  \tif (x) {\n  \t    f({{ .A }});\n  \t}\n  </script>\n</div>",
+		},
+		{
+			name: "style",
+			in:   "<style>\n        p {\n          color: {{ .C }};\n        }\n</style>",
+			want: "<style>\n\tp {\n\t  color: {{ .C }};\n\t}\n</style>",
+		},
+		{
+			name: "template-literal",
+			in:   "<script>\n  let s = `a\n      b ${ f(`\n  c`) }`;\n  g();\n</script>",
+			want: "<script>\n\tlet s = `a\n      b ${ f(`\n  c`) }`;\n\tg();\n</script>",
+		},
+		{
+			name: "string-continuation",
+			in:   "<script>\n  let s = 'a\\\n    b';\n  let r = /'/;\n  let d = x / 2; let q = '\n  h();\n</script>",
+			want: "<script>\n\tlet s = 'a\\\n    b';\n\tlet r = /'/;\n\tlet d = x / 2; let q = '\n\th();\n</script>",
+		},
+		{
+			name: "regexp-after-action",
+			in:   "<script>\n  let a = {{ .A }} / 2; let b = '\n  c();\n</script>",
+			want: "<script>\n\tlet a = {{ .A }} / 2; let b = '\n\tc();\n</script>",
+		},
+		{
+			name: "action-spans-lines",
+			in:   "<script>\n  {{ if .A }}\n    a();\n  {{ else }}\n    b();\n  {{ end }}\n</script>",
+			want: "<script>\n\t{{ if .A }}\n\t  a();\n\t{{ else }}\n\t  b();\n\t{{ end }}\n</script>",
+		},
+		{
+			name: "other-type",
+			in:   "<script type=\"text/x-template\">\n  <p>\n</script>",
+			want: "<script type=\"text/x-template\">\n  <p>\n</script>",
+		},
+		{
+			name: "json",
+			in:   "<script type=application/json>\n{\"a\": \"x\n  y\"}\n</script>",
+			want: "<script type=application/json>\n\t{\"a\": \"x\n\t  y\"}\n</script>",
+		},
+		{
+			name: "not-line-start",
+			in:   "<p><script>\n  a();\n</script>",
+			want: "<p><script>\n  a();\n</script>",
+		},
+		{
+			name: "off",
+			in:   "<script>\n{{/* gotmplfmt:off */}}\n  a();\n{{/* gotmplfmt:on */}}\n  b();\n</script>",
+			want: "<script>\n\t{{/* gotmplfmt:off */}}\n  a();\n{{/* gotmplfmt:on */}}\n\t  b();\n</script>",
+		},
+		{
+			name: "blank-and-comment",
+			in:   "<!-- <script> -->\n<SCRIPT>\n\n   /* a\n    * b\n    */\n   c();\n</SCRIPT>",
+			want: "<!-- <script> -->\n<SCRIPT>\n\n\t/* a\n\t * b\n\t */\n\tc();\n</SCRIPT>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := Parse(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			IndentScripts(root, "\t")
+			if got := root.String(); got != tt.want {
+				t.Errorf("IndentScripts(%q):\ngot:\n%s\nwant:\n%s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package ast
+
+// Simplify rewrites n to simplify its pipelines, in the spirit of gofmt -s.
+// For example,
+//
+//	{{ if (eq .A .B) }}            becomes {{ if eq .A .B }}
+//	{{ printf "%s" (.A) }}         becomes {{ printf "%s" .A }}
+//	{{ (.A).B }}                   becomes {{ .A.B }}
+//	{{ if not (not .A) }}          becomes {{ if .A }}
+//	{{ and .A }}                   becomes {{ .A }}
+//	{{ with $x := . }}{{ $x.A }}   becomes {{ with . }}{{ .A }}
+//	{{ or (eq .A 1) (eq .A 2) }}   becomes {{ eq .A 1 2 }}
+//
+// The rewrites preserve a template's output, assuming that the builtin
+// functions have not been overridden and that evaluating fields and methods
+// has no side effects: merging or and eq evaluates .A once rather than twice.
+func Simplify(n Node) {
+	simplify(n, true, offRegions(n))
+}
+
+// SimplifyPipes is like Simplify, but it rewrites only pipelines,
+// each in isolation, and not the with alias, which spans several actions.
+// It is for simplifying part of a template.
+func SimplifyPipes(n Node) {
+	simplify(n, false, nil)
+}
+
+// simplify simplifies n. If alias is set, it also rewrites with aliases,
+// except those whose branches overlap the gotmplfmt:off regions in off,
+// which the printer would copy with the old uses of the alias.
+func simplify(n Node, alias bool, off [][2]Pos) {
+	switch n := n.(type) {
+	case *ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			simplify(c, alias, off)
+		}
+	case *ActionNode:
+		simplifyPipe(n.Pipe)
+	case *BranchNode:
+		simplifyPipe(n.Pipe)
+		if n.Keyword == "if" {
+			simplifyCond(n.Pipe)
+		}
+		simplify(n.List, alias, off)
+		for _, e := range n.Elses {
+			if e.Pipe != nil {
+				simplifyPipe(e.Pipe)
+				simplifyCond(e.Pipe)
+			}
+			simplify(e.List, alias, off)
+		}
+		if n.Keyword == "with" && alias && !overlaps(off, n) {
+			simplifyWithAlias(n)
+		}
+	}
+}
+
+// simplifyPipe simplifies p and all pipelines nested within it, innermost first.
+func simplifyPipe(p *PipeNode) {
+	for _, c := range p.Cmds {
+		for i, arg := range c.Args {
+			switch arg := arg.(type) {
+			case *PipeNode:
+				simplifyPipe(arg)
+				if i > 0 {
+					c.Args[i] = unparen(arg)
+				}
+			case *ChainNode:
+				c.Args[i] = simplifyChain(arg)
+			}
+		}
+	}
+	mergeEqOr(p)
+	dropSingleAndOr(p)
+	spliceFirst(p)
+}
+
+// spliceFirst splices in a parenthesized pipeline that makes up
+// the entire first command of p: {{ (A | B) | C }} is {{ A | B | C }}.
+// This is not true of later commands: the parenthesized pipeline
+// is not a function, so it cannot accept the previous command's result.
+func spliceFirst(p *PipeNode) {
+	if len(p.Cmds) == 0 || len(p.Cmds[0].Args) != 1 {
+		return
+	}
+	inner, ok := p.Cmds[0].Args[0].(*PipeNode)
+	if !ok || len(inner.Decl) > 0 {
+		return
+	}
+	p.Cmds = append(inner.Cmds[:len(inner.Cmds):len(inner.Cmds)], p.Cmds[1:]...)
+}
+
+// unparen returns the operand inside p, if p is a redundantly
+// parenthesized argument such as (.A) or ($x), and p otherwise.
+//
+// Literals keep their parentheses: as arguments, constants
+// are converted to the parameter type, but parenthesized constants are not.
+func unparen(p *PipeNode) Node {
+	if len(p.Decl) > 0 || len(p.Cmds) != 1 || len(p.Cmds[0].Args) != 1 {
+		return p
+	}
+	switch arg := p.Cmds[0].Args[0]; arg.(type) {
+	case *FieldNode, *VariableNode, *DotNode, *ChainNode, *IdentifierNode:
+		return arg
+	}
+	return p
+}
+
+// simplifyChain simplifies a chain such as (.A).B to .A.B.
+func simplifyChain(c *ChainNode) Node {
+	p, ok := c.Node.(*PipeNode)
+	if !ok {
+		return c
+	}
+	simplifyPipe(p)
+	switch arg := unparen(p).(type) {
+	case *FieldNode:
+		return &FieldNode{tr: arg.tr, NodeType: NodeField, Pos: arg.Pos, Ident: append(arg.Ident[:len(arg.Ident):len(arg.Ident)], c.Field...)}
+	case *VariableNode:
+		return &VariableNode{tr: arg.tr, NodeType: NodeVariable, Pos: arg.Pos, Ident: append(arg.Ident[:len(arg.Ident):len(arg.Ident)], c.Field...)}
+	case *DotNode:
+		return &FieldNode{tr: arg.tr, NodeType: NodeField, Pos: arg.Pos, Ident: c.Field}
+	case *IdentifierNode:
+		c.Node = arg
+	}
+	return c
+}
+
+// isCall reports whether c is a call of the function named fn with n arguments.
+func isCall(c *CommandNode, fn string, n int) bool {
+	if len(c.Args) != n+1 {
+		return false
+	}
+	id, ok := c.Args[0].(*IdentifierNode)
+	return ok && id.Ident == fn
+}
+
+// simpleCmd returns the sole command of p, if p consists of
+// a single command with no declarations, and nil otherwise.
+func simpleCmd(p *PipeNode) *CommandNode {
+	if len(p.Decl) > 0 || len(p.Cmds) != 1 {
+		return nil
+	}
+	return p.Cmds[0]
+}
+
+// dropSingleAndOr rewrites {{ and X }} and {{ or X }} to {{ X }}.
+// With a single argument, both return that argument.
+// Only the first command qualifies; later commands receive an extra argument.
+// X must not be a constant, which would then head the command:
+// {{ nil }} is an error.
+func dropSingleAndOr(p *PipeNode) {
+	if len(p.Cmds) == 0 {
+		return
+	}
+	c := p.Cmds[0]
+	if (isCall(c, "and", 1) || isCall(c, "or", 1)) && !isConst(c.Args[1]) {
+		c.Args = c.Args[1:]
+	}
+}
+
+// isConst reports whether n is a constant: a string, number, boolean, or nil.
+func isConst(n Node) bool {
+	switch n.(type) {
+	case *StringNode, *NumberNode, *BoolNode, *NilNode:
+		return true
+	}
+	return false
+}
+
+// mergeEqOr rewrites {{ or (eq X A) (eq X B) }} to {{ eq X A B }}
+// when B and any later comparands are constants.
+// or stops at its first true argument, while eq evaluates all of its arguments
+// before comparing, so evaluating a later comparand that is not a constant
+// could fail where or would never have reached it.
+// The rewrite also evaluates X once rather than once per comparison.
+func mergeEqOr(p *PipeNode) {
+	if len(p.Cmds) == 0 {
+		return
+	}
+	c := p.Cmds[0]
+	if len(c.Args) < 3 || !isCall(c, "or", len(c.Args)-1) {
+		return
+	}
+	var merged []Node
+	for _, arg := range c.Args[1:] {
+		inner, ok := arg.(*PipeNode)
+		if !ok {
+			return
+		}
+		eq := simpleCmd(inner)
+		if eq == nil || len(eq.Args) < 3 || !isCall(eq, "eq", len(eq.Args)-1) {
+			return
+		}
+		if merged == nil {
+			merged = append(merged, eq.Args...)
+			continue
+		}
+		if eq.Args[1].String() != merged[1].String() {
+			return
+		}
+		for _, arg := range eq.Args[2:] {
+			if !isConst(arg) {
+				return
+			}
+		}
+		merged = append(merged, eq.Args[2:]...)
+	}
+	c.Args = merged
+}
+
+// simplifyCond simplifies p, which is the condition of an if or else if,
+// and so is only checked for truth.
+// It rewrites {{ if not (not X) }} to {{ if X }}.
+func simplifyCond(p *PipeNode) {
+	for {
+		c := simpleCmd(p)
+		if c == nil || !isCall(c, "not", 1) {
+			return
+		}
+		inner, ok := c.Args[1].(*PipeNode)
+		if !ok {
+			return
+		}
+		ic := simpleCmd(inner)
+		if ic == nil || !isCall(ic, "not", 1) {
+			return
+		}
+		c.Args = ic.Args[1:]
+		spliceFirst(p)
+	}
+}
+
+// simplifyWithAlias rewrites {{ with $x := . }} to {{ with . }},
+// replacing uses of $x with dot.
+// It does so only when dot means the same thing everywhere $x is used,
+// that is, when the body does not contain any branches that change dot,
+// and when $x is not redeclared or reassigned.
+func simplifyWithAlias(b *BranchNode) {
+	p := b.Pipe
+	if len(p.Decl) != 1 || p.IsAssign || len(p.Cmds) != 1 || len(p.Cmds[0].Args) != 1 {
+		return
+	}
+	if _, ok := p.Cmds[0].Args[0].(*DotNode); !ok {
+		return
+	}
+	name := p.Decl[0].Ident[0]
+	body := []Node{b.List}
+	for _, e := range b.Elses {
+		body = append(body, e)
+	}
+	ok := true
+	for _, n := range body {
+		eachBranch(n, func(br *BranchNode) {
+			if br.Keyword != "if" {
+				ok = false
+			}
+		})
+		eachPipe(n, func(p *PipeNode) {
+			for _, v := range p.Decl {
+				if v.Ident[0] == name {
+					ok = false
+				}
+			}
+		})
+	}
+	if !ok {
+		return
+	}
+	for _, n := range body {
+		eachPipe(n, func(p *PipeNode) {
+			for _, c := range p.Cmds {
+				for i, arg := range c.Args {
+					v, ok := arg.(*VariableNode)
+					if !ok || v.Ident[0] != name {
+						continue
+					}
+					if len(v.Ident) == 1 {
+						c.Args[i] = &DotNode{tr: v.tr, NodeType: NodeDot, Pos: v.Pos}
+					} else {
+						c.Args[i] = &FieldNode{tr: v.tr, NodeType: NodeField, Pos: v.Pos, Ident: v.Ident[1:]}
+					}
+				}
+			}
+		})
+	}
+	p.Decl = nil
+}
+
+// eachPipe calls f on every pipeline in n,
+// including parenthesized pipelines nested in arguments.
+func eachPipe(n Node, f func(*PipeNode)) {
+	Inspect(n, func(n Node) bool {
+		if p, ok := n.(*PipeNode); ok {
+			f(p)
+		}
+		return true
+	})
+}
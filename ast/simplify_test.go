@@ -0,0 +1,73 @@
+package ast
+
+import "testing"
+
+var simplifyTests = []struct {
+	in, want string
+}{
+	{`{{ if (eq .A .B) }}x{{ end }}`, `{{ if eq .A .B }}x{{ end }}`},
+	{`{{ (.Foo) }}`, `{{ .Foo }}`},
+	{`{{ ((.Foo)) }}`, `{{ .Foo }}`},
+	{`{{ (.A | f) | g }}`, `{{ .A | f | g }}`},
+	{`{{ $x := (.A) }}`, `{{ $x := .A }}`},
+	{`{{ printf "%s" (.A) ($x) (.) (f) }}`, `{{ printf "%s" .A $x . f }}`},
+	{`{{ printf "%s" (f .A) }}`, `{{ printf "%s" (f .A) }}`},
+	{`{{ printf "%s" (1) ("x") }}`, `{{ printf "%s" (1) ("x") }}`},
+	{`{{ printf "%s" (.A | f) }}`, `{{ printf "%s" (.A | f) }}`},
+	{`{{ (.A).B }}`, `{{ .A.B }}`},
+	{`{{ ($x.A).B }}`, `{{ $x.A.B }}`},
+	{`{{ (.).B }}`, `{{ .B }}`},
+	{`{{ (f).B }}`, `{{ f.B }}`},
+	{`{{ (f .A).B }}`, `{{ (f .A).B }}`},
+	{`{{ .A | (f) }}`, `{{ .A | (f) }}`},
+	{`{{ ($x := .A) }}`, `{{ ($x := .A) }}`},
+	{`{{ with .A }}{{ else if (.B) }}{{ f (.C) }}{{ end }}`, `{{ with .A }}{{ else if .B }}{{ f .C }}{{ end }}`},
+
+	// not (not X)
+	{`{{ if not (not .A) }}x{{ end }}`, `{{ if .A }}x{{ end }}`},
+	{`{{ if not (not (not (not (f .A)))) }}x{{ end }}`, `{{ if f .A }}x{{ end }}`},
+	{`{{ if .A }}{{ else if not (not .B) }}x{{ end }}`, `{{ if .A }}{{ else if .B }}x{{ end }}`},
+	{`{{ not (not .A) }}`, `{{ not (not .A) }}`},
+	{`{{ with not (not .A) }}x{{ end }}`, `{{ with not (not .A) }}x{{ end }}`},
+	{`{{ if $x := not (not .A) }}x{{ end }}`, `{{ if $x := not (not .A) }}x{{ end }}`},
+
+	// and X, or X
+	{`{{ and .A }}`, `{{ .A }}`},
+	{`{{ or (f .A) }}`, `{{ f .A }}`},
+	{`{{ printf "%v" (and .A) }}`, `{{ printf "%v" .A }}`},
+	{`{{ and .A .B }}`, `{{ and .A .B }}`},
+	{`{{ .A | and .B }}`, `{{ .A | and .B }}`},
+	{`{{ and nil }}`, `{{ and nil }}`},
+	{`{{ or "x" }}`, `{{ or "x" }}`},
+
+	// with $x := .
+	{`{{ with $x := . }}{{ $x }}{{ $x.A.B }}{{ f $x }}{{ end }}`, `{{ with . }}{{ . }}{{ .A.B }}{{ f . }}{{ end }}`},
+	{`{{ with $x := . }}{{ if $x.A }}{{ (f $x).B }}{{ end }}{{ else }}{{ $x }}{{ end }}`, `{{ with . }}{{ if .A }}{{ (f .).B }}{{ end }}{{ else }}{{ . }}{{ end }}`},
+	{`{{ with $x := . }}{{ range .A }}{{ $x }}{{ end }}{{ end }}`, `{{ with $x := . }}{{ range .A }}{{ $x }}{{ end }}{{ end }}`},
+	{`{{ with $x := . }}{{ $x = 1 }}{{ $x }}{{ end }}`, `{{ with $x := . }}{{ $x = 1 }}{{ $x }}{{ end }}`},
+	{`{{ with $x := .A }}{{ $x }}{{ end }}`, `{{ with $x := .A }}{{ $x }}{{ end }}`},
+	{`{{ with $x = . }}{{ $x }}{{ end }}`, `{{ with $x = . }}{{ $x }}{{ end }}`},
+
+	// or (eq X A) (eq X B)
+	{`{{ if or (eq .A "x") (eq .A "y") }}x{{ end }}`, `{{ if eq .A "x" "y" }}x{{ end }}`},
+	{`{{ or (eq .A 1 2) (eq .A 3) (eq .A 4) }}`, `{{ eq .A 1 2 3 4 }}`},
+	{`{{ or (eq .A 1) (eq .B 2) }}`, `{{ or (eq .A 1) (eq .B 2) }}`},
+	{`{{ or (eq .A 1) (ne .A 2) }}`, `{{ or (eq .A 1) (ne .A 2) }}`},
+	{`{{ or (eq .A 1) .B }}`, `{{ or (eq .A 1) .B }}`},
+	{`{{ or (eq .A .B) (eq .A 1) }}`, `{{ eq .A .B 1 }}`},
+	{`{{ or (eq .A 1) (eq .A .B.C) }}`, `{{ or (eq .A 1) (eq .A .B.C) }}`},
+	{`{{ or (eq .A 1) (eq .A true nil) }}`, `{{ eq .A 1 true nil }}`},
+}
+
+func TestSimplify(t *testing.T) {
+	for _, tt := range simplifyTests {
+		root, err := Parse(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		Simplify(root)
+		if got := root.String(); got != tt.want {
+			t.Errorf("Simplify(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses a tree in depth-first order: It starts by calling v.Visit(node);
+// node must not be nil. If the visitor w returned by v.Visit(node) is not nil,
+// Walk is invoked recursively with visitor w for each of the non-nil children
+// of node, followed by a call of w.Visit(nil).
+//
+// The children of a BranchNode are its Pipe, List, Elses, and End, in that order.
+// The children of an ElseNode are its Pipe, if any, and its List.
+// Parenthesized pipelines appear as PipeNode arguments of a CommandNode
+// or as the Node of a ChainNode.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *TextNode, *CommentNode, *IdentifierNode, *VariableNode, *DotNode, *NilNode,
+		*FieldNode, *BoolNode, *NumberNode, *StringNode, *EndNode:
+		// nothing to do
+
+	case *ListNode:
+		for _, c := range n.Nodes {
+			Walk(v, c)
+		}
+
+	case *PipeNode:
+		for _, d := range n.Decl {
+			Walk(v, d)
+		}
+		for _, c := range n.Cmds {
+			Walk(v, c)
+		}
+
+	case *ActionNode:
+		Walk(v, n.Pipe)
+
+	case *CommandNode:
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+
+	case *ChainNode:
+		Walk(v, n.Node)
+
+	case *ElseNode:
+		if n.Pipe != nil {
+			Walk(v, n.Pipe)
+		}
+		if n.List != nil {
+			Walk(v, n.List)
+		}
+
+	case *BranchNode:
+		Walk(v, n.Pipe)
+		if n.List != nil {
+			Walk(v, n.List)
+		}
+		for _, e := range n.Elses {
+			Walk(v, e)
+		}
+		if n.Close != nil {
+			Walk(v, n.Close)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a tree in depth-first order: It starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a
+// call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,63 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	const src = `{{ if $x := .A }}a{{ else if eq (f .B) 1 }}{{/* c */}}{{ else }}{{ ($x).C }}{{ end }}`
+	root, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	depth := 0
+	Inspect(root, func(n Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		got = append(got, fmt.Sprintf("%s%T %s", strings.Repeat(".", depth), n, n))
+		depth++
+		return true
+	})
+	want := []string{
+		`*ast.ListNode ` + src,
+		`.*ast.BranchNode ` + src,
+		`..*ast.PipeNode $x := .A`,
+		`...*ast.VariableNode $x`,
+		`...*ast.CommandNode .A`,
+		`....*ast.FieldNode .A`,
+		`..*ast.ListNode a`,
+		`...*ast.TextNode a`,
+		`..*ast.ElseNode {{ else if eq (f .B) 1 }}{{/* c */}}`,
+		`...*ast.PipeNode eq (f .B) 1`,
+		`....*ast.CommandNode eq (f .B) 1`,
+		`.....*ast.IdentifierNode eq`,
+		`.....*ast.PipeNode f .B`,
+		`......*ast.CommandNode f .B`,
+		`.......*ast.IdentifierNode f`,
+		`.......*ast.FieldNode .B`,
+		`.....*ast.NumberNode 1`,
+		`...*ast.ListNode {{/* c */}}`,
+		`....*ast.CommentNode {{/* c */}}`,
+		`..*ast.ElseNode {{ else }}{{ ($x).C }}`,
+		`...*ast.ListNode {{ ($x).C }}`,
+		`....*ast.ActionNode {{ ($x).C }}`,
+		`.....*ast.PipeNode ($x).C`,
+		`......*ast.CommandNode ($x).C`,
+		`.......*ast.ChainNode ($x).C`,
+		`........*ast.PipeNode $x`,
+		`.........*ast.CommandNode $x`,
+		`..........*ast.VariableNode $x`,
+		`..*ast.EndNode {{ end }}`,
+	}
+	if g, w := strings.Join(got, "\n"), strings.Join(want, "\n"); g != w {
+		t.Errorf("Inspect visited:\n%s\nwant:\n%s", g, w)
+	}
+	if depth != 0 {
+		t.Errorf("Inspect made %d more calls to f(n) than to f(nil)", depth)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// isPackagePattern reports whether arg names Go packages rather than a template file:
+// a directory, or a directory followed by /... for it and all packages below it.
+func isPackagePattern(arg string) bool {
+	if arg == "..." || strings.HasSuffix(arg, "/...") {
+		return true
+	}
+	fi, err := os.Stat(arg)
+	return err == nil && fi.IsDir()
+}
+
+// templateFiles returns the template files named by args,
+// which are files or package patterns whose embedded templates are included.
+func templateFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		if !isPackagePattern(arg) {
+			files = append(files, arg)
+			continue
+		}
+		embedded, err := embeddedTemplates(arg)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, embedded...)
+	}
+	return files, nil
+}
+
+// embeddedTemplates returns the template files loaded by the packages matching pattern.
+//
+// A template file is one embedded with //go:embed into a variable
+// that is passed to a ParseFS function or method, such as template.ParseFS,
+// and that matches one of the patterns passed alongside it.
+// Packages are read from disk with go/build and go/parser;
+// nothing is downloaded, and imported packages are not consulted.
+func embeddedTemplates(pattern string) ([]string, error) {
+	var dirs []string
+	if root, ok := strings.CutSuffix(pattern, "..."); ok {
+		root = filepath.Clean(strings.TrimSuffix(root, "/"))
+		if root == "" {
+			root = "."
+		}
+		err := filepath.WalkDir(root, func(dir string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return err
+			}
+			if dir != root {
+				// Skip what the go command skips, including nested modules.
+				name := d.Name()
+				if name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+					return filepath.SkipDir
+				}
+				if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			dirs = append(dirs, dir)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		dirs = []string{pattern}
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	for _, dir := range dirs {
+		pkgFiles, err := packageTemplates(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range pkgFiles {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// packageTemplates returns the template files loaded by the package in dir.
+func packageTemplates(dir string) ([]string, error) {
+	pkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		var noGo *build.NoGoError
+		if errors.As(err, &noGo) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(pkg.EmbedPatterns) == 0 {
+		return nil, nil
+	}
+
+	fset := token.NewFileSet()
+	embeds := make(map[string][]string) // variable name -> its //go:embed patterns
+	var calls []*ast.CallExpr           // calls to ParseFS
+	for _, name := range pkg.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				doc := vs.Doc
+				if doc == nil && len(gd.Specs) == 1 {
+					doc = gd.Doc
+				}
+				patterns, err := embedPatterns(doc)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", fset.Position(vs.Pos()), err)
+				}
+				if len(patterns) > 0 && len(vs.Names) == 1 {
+					embeds[vs.Names[0].Name] = patterns
+				}
+			}
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if ok && sel.Sel.Name == "ParseFS" && len(call.Args) >= 2 {
+				calls = append(calls, call)
+			}
+			return true
+		})
+	}
+
+	var files []string
+	for _, call := range calls {
+		id, ok := call.Args[0].(*ast.Ident)
+		if !ok || embeds[id.Name] == nil {
+			continue
+		}
+		embedded, err := embeddedFiles(dir, embeds[id.Name])
+		if err != nil {
+			return nil, err
+		}
+		var globs []string
+		for _, arg := range call.Args[1:] {
+			lit, ok := arg.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				// Can't tell which files a computed pattern loads.
+				globs = nil
+				break
+			}
+			glob, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return nil, err
+			}
+			globs = append(globs, glob)
+		}
+		for _, file := range embedded {
+			for _, glob := range globs {
+				if ok, _ := path.Match(glob, file); ok {
+					files = append(files, filepath.Join(dir, filepath.FromSlash(file)))
+					break
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+// embedPatterns returns the patterns of the //go:embed directives in doc.
+func embedPatterns(doc *ast.CommentGroup) ([]string, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	var patterns []string
+	for _, c := range doc.List {
+		args, ok := strings.CutPrefix(c.Text, "//go:embed")
+		if !ok || args != "" && args[0] != ' ' && args[0] != '\t' {
+			continue
+		}
+		for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+			var pattern string
+			switch args[0] {
+			case '"', '`':
+				quoted, err := strconv.QuotedPrefix(args)
+				if err != nil {
+					return nil, fmt.Errorf("invalid quoted string in //go:embed: %s", args)
+				}
+				pattern, _ = strconv.Unquote(quoted)
+				args = args[len(quoted):]
+			default:
+				i := strings.IndexAny(args, " \t")
+				if i < 0 {
+					i = len(args)
+				}
+				pattern, args = args[:i], args[i:]
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns, nil
+}
+
+// embeddedFiles returns the slash-separated paths, relative to dir,
+// of the files that the //go:embed patterns embed.
+// As with go:embed, directories are embedded recursively,
+// omitting files whose names begin with . or _ unless the pattern begins with all:.
+func embeddedFiles(dir string, patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		pattern, all := strings.CutPrefix(pattern, "all:")
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(file string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if file != match && !all && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "_")) {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if d.Type().IsRegular() {
+					rel, err := filepath.Rel(dir, file)
+					if err != nil {
+						return err
+					}
+					files = append(files, filepath.ToSlash(rel))
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEmbeddedTemplates(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/m\n",
+		"web/web.go": `package web
+
+import (
+	"embed"
+	"html/template"
+)
+
+//go:embed templates/*.gohtml "templates/x y.gohtml" static
+var fsys embed.FS
+
+// Not loaded as templates.
+//
+//go:embed static
+var static embed.FS
+
+var t = template.Must(template.ParseFS(fsys, "templates/*.gohtml", "static/*.gohtml"))
+`,
+		"web/templates/a.gohtml":    "{{.A}}",
+		"web/templates/x y.gohtml":  "{{.B}}",
+		"web/templates/c.txt":       "not embedded",
+		"web/static/s.gohtml":       "{{.S}}",
+		"web/static/_hidden.gohtml": "not embedded",
+		"web/static/s.css":          "not parsed",
+		"other/other.go":            "package other\n",
+		"testdata/t/t.go":           "package t\n\nimport \"embed\"\n\n//go:embed *.gohtml\nvar f embed.FS\n\nvar _ = x.ParseFS(f, \"*\")\n",
+		"testdata/t/t.gohtml":       "skipped",
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := embeddedTemplates(dir + "/...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "web", "static", "s.gohtml"),
+		filepath.Join(dir, "web", "templates", "a.gohtml"),
+		filepath.Join(dir, "web", "templates", "x y.gohtml"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("embeddedTemplates = %q, want %q", got, want)
+	}
+}
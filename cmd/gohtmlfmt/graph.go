@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/josharian/gotmplfmt/internal/vet"
+)
+
+// runGraph writes the call graph of the template set in args,
+// which are flags followed by files or package patterns,
+// to standard output in the -graph format.
+// It prints undefined, unused, and recursive templates to standard error
+// and reports whether there were any.
+func runGraph(args []string) (ok bool, err error) {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	graphFormat := fs.String("graph", "dot", "the output `format`: dot or json")
+	fs.Parse(args)
+	trees, err := parseSet(fs.Args())
+	if err != nil {
+		return false, err
+	}
+	g := vet.NewGraph(trees)
+	switch *graphFormat {
+	case "dot":
+		err = g.WriteDOT(os.Stdout)
+	case "json":
+		err = g.WriteJSON(os.Stdout)
+	default:
+		err = fmt.Errorf("unknown -graph format %q", *graphFormat)
+	}
+	if err != nil {
+		return false, err
+	}
+	diags := append(g.Check(), g.CheckCycles()...)
+	for _, d := range diags {
+		fmt.Fprintln(os.Stderr, d)
+	}
+	return len(diags) == 0, nil
+}
@@ -4,14 +4,95 @@ import (
 	"flag"
 	"log"
 	"os"
+	"path/filepath"
 
+	"github.com/josharian/gotmplfmt/ast"
+	"github.com/josharian/gotmplfmt/internal/lsp"
 	"github.com/josharian/gotmplfmt/tmplfmt"
 )
 
+var (
+	elseIf   = flag.String("elseif", "", "rewrite else-if chains: `style` is collapse or expand")
+	simplify = flag.Bool("s", false, "simplify code")
+	strs     = flag.Bool("strings", false, "canonicalize string literals")
+	nums     = flag.Bool("numbers", false, "canonicalize number literals")
+	scripts  = flag.Bool("scripts", false, "re-indent <script> and <style> bodies")
+	mode     = flag.String("mode", "", "kind of document: `mode` is html, yaml, or text (default by file extension)")
+	goSrc    = flag.Bool("go", false, "format the templates in a Go source file")
+	dumpAST  = flag.String("ast", "", "print the syntax tree to standard output instead of formatting: `format` is text or json")
+)
+
 func main() {
 	flag.Parse()
 	log.SetFlags(0)
+	opts := tmplfmt.Options{
+		Simplify:         *simplify,
+		CanonicalStrings: *strs,
+		CanonicalNumbers: *nums,
+		IndentScripts:    *scripts,
+	}
+	switch *elseIf {
+	case "":
+	case "collapse":
+		opts.ElseIf = tmplfmt.ElseIfCollapse
+	case "expand":
+		opts.ElseIf = tmplfmt.ElseIfExpand
+	default:
+		log.Fatalf("unknown -elseif style %q", *elseIf)
+	}
+	if flag.NArg() == 1 && flag.Arg(0) == "lsp" {
+		s := &lsp.Server{Options: opts, Mode: docMode}
+		if err := s.Run(os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if cmd := flag.Arg(0); cmd == "vet" || cmd == "graph" {
+		run := runVet
+		if cmd == "graph" {
+			run = runGraph
+		}
+		ok, err := run(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+	if isPackagePattern(flag.Arg(0)) {
+		// Format the embedded templates of every pattern in place,
+		// along with any template files listed among them.
+		if *dumpAST != "" || *goSrc {
+			log.Fatal("-ast and -go apply to a single file, not to package patterns")
+		}
+		files, err := templateFiles(flag.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, file := range files {
+			buf, err := os.ReadFile(file)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts.Mode = docMode(file)
+			out, err := opts.Format(string(buf))
+			if err != nil {
+				log.Fatalf("%s: %v", file, err)
+			}
+			if out == string(buf) {
+				continue
+			}
+			err = os.WriteFile(file, []byte(out), 0o644)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	}
 	inpath := flag.Arg(0)
+	opts.Mode = docMode(inpath)
 	outpath := inpath
 	if flag.NArg() > 1 {
 		outpath = flag.Arg(1)
@@ -20,7 +101,29 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	out, err := tmplfmt.Format(string(buf))
+	if *dumpAST != "" {
+		tree, err := ast.ParseFile(inpath, string(buf))
+		if err != nil {
+			log.Fatal(err)
+		}
+		switch *dumpAST {
+		case "text":
+			err = ast.Dump(os.Stdout, tree.Root)
+		case "json":
+			err = ast.DumpJSON(os.Stdout, tree.Root)
+		default:
+			log.Fatalf("unknown -ast format %q", *dumpAST)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	format := opts.Format
+	if *goSrc {
+		format = opts.FormatGo
+	}
+	out, err := format(string(buf))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -29,3 +132,20 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// docMode returns the document mode for the file at path:
+// the -mode flag if set, and otherwise a guess from its extension.
+func docMode(path string) tmplfmt.Mode {
+	switch *mode {
+	case "html":
+		return tmplfmt.HTML
+	case "yaml":
+		return tmplfmt.YAML
+	case "text":
+		return tmplfmt.Text
+	case "":
+	default:
+		log.Fatalf("unknown -mode %q", *mode)
+	}
+	return tmplfmt.ModeForFile(filepath.ToSlash(path))
+}
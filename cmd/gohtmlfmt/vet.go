@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/importer"
+	"go/token"
+	"os"
+	"strings"
+
+	"github.com/josharian/gotmplfmt/ast"
+	"github.com/josharian/gotmplfmt/internal/vet"
+)
+
+// runVet checks the templates in args, which are flags followed by
+// files or package patterns, as one template set.
+// It prints the problems it finds to standard error
+// and reports whether there were any.
+func runVet(args []string) (ok bool, err error) {
+	fs := flag.NewFlagSet("vet", flag.ExitOnError)
+	funcs := fs.String("funcs", "", "check function calls against the builtins and a comma-separated `list` of sprig, helm, Go package directories, and function list files")
+	dotTypes := fs.String("types", "", "a comma-separated `list` of pattern=import/path.Type giving the type of dot in files whose base names match pattern")
+	fs.Parse(args)
+	trees, err := parseSet(fs.Args())
+	if err != nil {
+		return false, err
+	}
+	cfg := vet.Config{Importer: importer.ForCompiler(token.NewFileSet(), "source", nil)}
+	if *dotTypes != "" {
+		cfg.Types = make(map[string]string)
+		for _, kv := range strings.Split(*dotTypes, ",") {
+			pattern, typ, ok := strings.Cut(kv, "=")
+			if !ok {
+				return false, fmt.Errorf("invalid -types entry %q: want pattern=import/path.Type", kv)
+			}
+			cfg.Types[pattern] = typ
+		}
+	}
+	if *funcs != "" {
+		cfg.Funcs, err = vet.LoadFuncs(strings.Split(*funcs, ","))
+		if err != nil {
+			return false, err
+		}
+	}
+	diags := cfg.Check(trees)
+	for _, d := range diags {
+		fmt.Fprintln(os.Stderr, d)
+	}
+	return len(diags) == 0, nil
+}
+
+// parseSet parses the templates in args, which are files or package patterns
+// whose embedded templates form one template set.
+func parseSet(args []string) ([]*ast.Tree, error) {
+	files, err := templateFiles(args)
+	if err != nil {
+		return nil, err
+	}
+	var trees []*ast.Tree
+	for _, file := range files {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		tree, err := ast.ParseFile(file, string(buf))
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, tree)
+	}
+	return trees, nil
+}
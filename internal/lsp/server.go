@@ -0,0 +1,402 @@
+// Package lsp implements a language server for Go templates.
+//
+// The server speaks the Language Server Protocol over a stream, such as stdio.
+// It formats documents, reports parse errors as diagnostics,
+// lists define and block actions as document symbols,
+// and goes from {{ template "x" }} to the definition of "x".
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/josharian/gotmplfmt/ast"
+	"github.com/josharian/gotmplfmt/tmplfmt"
+)
+
+// A Server is a language server for Go templates.
+type Server struct {
+	// Options are the formatting options.
+	// Their Mode is replaced by the result of Mode for each document.
+	Options tmplfmt.Options
+	// Mode returns the mode for the file with the given path.
+	// If nil, tmplfmt.ModeForFile is used.
+	Mode func(path string) tmplfmt.Mode
+
+	docs map[string]*document
+	w    io.Writer
+}
+
+// Run serves requests read from r, writing responses and notifications to w,
+// until it receives an exit notification or r is exhausted.
+func (s *Server) Run(r io.Reader, w io.Writer) error {
+	s.docs = make(map[string]*document)
+	s.w = w
+	br := bufio.NewReader(r)
+	for {
+		body, err := readMessage(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return err
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, err := s.handle(req.Method, req.Params)
+		if req.ID == nil {
+			// A notification; there is no one to tell about errors.
+			continue
+		}
+		resp := response{JSONRPC: "2.0", ID: req.ID}
+		var rerr *responseError
+		switch {
+		case errors.As(err, &rerr):
+			resp.Error = rerr
+		case err != nil:
+			resp.Error = &responseError{Code: codeRequestFailed, Message: err.Error()}
+		default:
+			resp.Result, err = json.Marshal(result)
+			if err != nil {
+				return err
+			}
+		}
+		if err := s.send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *responseError) Error() string { return e.Message }
+
+// readMessage reads a single base protocol message from r and returns its content.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length < 0 {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(name, "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing Content-Length")
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+// send writes msg to the client as a base protocol message.
+func (s *Server) send(msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// handle handles the request or notification method with the given params.
+func (s *Server) handle(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":                1, // full
+				"documentFormattingProvider":      true,
+				"documentRangeFormattingProvider": true,
+				"documentSymbolProvider":          true,
+				"definitionProvider":              true,
+			},
+			"serverInfo": map[string]any{"name": "gohtmlfmt"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		return nil, s.open(p.TextDocument.URI, p.TextDocument.Text)
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		if len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		// The server asks for full document sync, so the last change holds the whole text.
+		return nil, s.open(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, s.publishDiagnostics(p.TextDocument.URI, nil)
+	case "textDocument/formatting":
+		var p formattingParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		d, err := s.doc(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return s.format(d)
+	case "textDocument/rangeFormatting":
+		var p rangeFormattingParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		d, err := s.doc(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return s.formatRange(d, p.Range)
+	case "textDocument/documentSymbol":
+		var p documentSymbolParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		d, err := s.doc(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return symbols(d), nil
+	case "textDocument/definition":
+		var p textDocumentPositionParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		d, err := s.doc(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return s.definition(d, d.offset(p.Position)), nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + method}
+}
+
+func unmarshalParams(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// doc returns the open document with the given URI.
+func (s *Server) doc(uri string) (*document, error) {
+	d, ok := s.docs[uri]
+	if !ok {
+		return nil, fmt.Errorf("document not open: %s", uri)
+	}
+	return d, nil
+}
+
+// open records the text of the document with the given URI and publishes its diagnostics.
+func (s *Server) open(uri, text string) error {
+	d := newDocument(uri, text)
+	s.docs[uri] = d
+	var diags []Diagnostic
+	if _, err := ast.ParseFile("", text); err != nil {
+		diags = append(diags, d.diagnostic(err))
+	}
+	return s.publishDiagnostics(uri, diags)
+}
+
+func (s *Server) publishDiagnostics(uri string, diags []Diagnostic) error {
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	return s.send(notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  publishDiagnosticsParams{URI: uri, Diagnostics: diags},
+	})
+}
+
+// parseErrorRE matches the errors returned by ast.ParseFile for an unnamed template.
+var parseErrorRE = regexp.MustCompile(`^template: (\d+): (.*)$`)
+
+// diagnostic returns the diagnostic for the parse error err in d.
+// Parse errors only carry a line, so the diagnostic covers that whole line.
+func (d *document) diagnostic(err error) Diagnostic {
+	line, msg := 0, err.Error()
+	if m := parseErrorRE.FindStringSubmatch(msg); m != nil {
+		line, _ = strconv.Atoi(m[1])
+		line--
+		msg = m[2]
+	}
+	start := d.offset(Position{Line: line})
+	end := d.offset(Position{Line: line + 1})
+	if end > start && d.text[end-1] == '\n' {
+		end--
+	}
+	return Diagnostic{Range: d.span(start, end), Severity: severityError, Source: "gohtmlfmt", Message: msg}
+}
+
+// options returns the formatting options for d.
+func (s *Server) options(d *document) tmplfmt.Options {
+	opts := s.Options
+	path := d.uri
+	if u, err := url.Parse(d.uri); err == nil && u.Path != "" {
+		path = u.Path
+	}
+	if s.Mode != nil {
+		opts.Mode = s.Mode(path)
+	} else {
+		opts.Mode = tmplfmt.ModeForFile(path)
+	}
+	return opts
+}
+
+// format returns the edits that format d.
+func (s *Server) format(d *document) ([]TextEdit, error) {
+	edits, err := s.options(d).FormatEdits(d.text)
+	if err != nil {
+		return nil, err
+	}
+	return d.textEdits(edits), nil
+}
+
+// formatRange formats the part of d in r.
+func (s *Server) formatRange(d *document, r Range) ([]TextEdit, error) {
+	edits, err := s.options(d).FormatRange(d.text, d.offset(r.Start), d.offset(r.End))
+	if err != nil {
+		return nil, err
+	}
+	return d.textEdits(edits), nil
+}
+
+// symbols returns the define and block actions in d, nested as in the template.
+func symbols(d *document) []DocumentSymbol {
+	tree, err := ast.ParseFile("", d.text)
+	if err != nil {
+		return []DocumentSymbol{}
+	}
+	var list func(n ast.Node) []DocumentSymbol
+	list = func(n ast.Node) []DocumentSymbol {
+		syms := []DocumentSymbol{}
+		ast.Inspect(n, func(m ast.Node) bool {
+			b, ok := m.(*ast.BranchNode)
+			if !ok || m == n {
+				return true
+			}
+			name := templateName(b.Pipe, 0)
+			if name == nil || b.Keyword != "define" && b.Keyword != "block" {
+				return true
+			}
+			syms = append(syms, DocumentSymbol{
+				Name:           name.Text,
+				Detail:         b.Keyword,
+				Kind:           symbolKindFunction,
+				Range:          d.span(int(b.Position()), int(b.End())),
+				SelectionRange: d.span(int(name.Position()), int(name.End())),
+				Children:       list(b),
+			})
+			return false
+		})
+		return syms
+	}
+	return list(tree.Root)
+}
+
+// templateName returns the string argument at index i of the sole command in p,
+// which names a template in define, block, and template actions.
+func templateName(p *ast.PipeNode, i int) *ast.StringNode {
+	if p == nil || len(p.Cmds) != 1 || len(p.Cmds[0].Args) <= i {
+		return nil
+	}
+	s, _ := p.Cmds[0].Args[i].(*ast.StringNode)
+	return s
+}
+
+// definition returns the location of the define or block action for the
+// {{ template "x" }} action at byte offset off in d.
+// It searches d first, and then the other open documents.
+func (s *Server) definition(d *document, off int) []Location {
+	tree, err := ast.ParseFile("", d.text)
+	if err != nil {
+		return []Location{}
+	}
+	var name string
+	ast.Inspect(tree.Root, func(n ast.Node) bool {
+		if n == nil || off < int(n.Position()) || int(n.End()) < off {
+			return false
+		}
+		if a, ok := n.(*ast.ActionNode); ok {
+			if id, ok := a.Pipe.Cmds[0].Args[0].(*ast.IdentifierNode); ok && id.Ident == "template" {
+				if str := templateName(a.Pipe, 1); str != nil {
+					name = str.Text
+				}
+			}
+		}
+		return true
+	})
+	if name == "" {
+		return []Location{}
+	}
+	var others []*document
+	for _, other := range s.docs {
+		if other != d {
+			others = append(others, other)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].uri < others[j].uri })
+	docs := append([]*document{d}, others...)
+	var locs []Location
+	for _, doc := range docs {
+		tree, err := ast.ParseFile("", doc.text)
+		if err != nil {
+			continue
+		}
+		ast.Inspect(tree.Root, func(n ast.Node) bool {
+			b, ok := n.(*ast.BranchNode)
+			if !ok || b.Keyword != "define" && b.Keyword != "block" {
+				return true
+			}
+			if str := templateName(b.Pipe, 0); str != nil && str.Text == name {
+				locs = append(locs, Location{URI: doc.uri, Range: doc.span(int(str.Position()), int(str.End()))})
+			}
+			return true
+		})
+		if len(locs) > 0 {
+			break
+		}
+	}
+	if locs == nil {
+		locs = []Location{}
+	}
+	return locs
+}
@@ -0,0 +1,123 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// session runs a server on the given messages and returns what it wrote,
+// decoded from JSON, one entry per message.
+func session(t *testing.T, s *Server, msgs ...string) []map[string]any {
+	t.Helper()
+	var in strings.Builder
+	for _, msg := range msgs {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	var out strings.Builder
+	if err := s.Run(strings.NewReader(in.String()), &out); err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]any
+	r := bufio.NewReader(strings.NewReader(out.String()))
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var m map[string]any
+		if err := json.Unmarshal(body, &m); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, m)
+	}
+	return got
+}
+
+func open(uri, text string) string {
+	b, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "textDocument/didOpen",
+		"params":  map[string]any{"textDocument": map[string]any{"uri": uri, "languageId": "gotmpl", "version": 1, "text": text}},
+	})
+	return string(b)
+}
+
+func call(id int, method string, params any) string {
+	b, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	return string(b)
+}
+
+func doc(uri string) map[string]any {
+	return map[string]any{"uri": uri}
+}
+
+func jsonString(v any) string {
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return sb.String()
+}
+
+func TestServer(t *testing.T) {
+	const page = "{{define \"page\"}}\n<p>{{.A}}</p>\n{{template \"row\" .}}\n{{end}}\n"
+	const helpers = "{{ define \"row\" }}<tr>{{ block \"cell\" . }}<td>{{ end }}</tr>{{ end }}\n"
+	got := session(t, new(Server),
+		call(1, "initialize", map[string]any{}),
+		open("file:///a.html", page),
+		open("file:///b.html", helpers),
+		open("file:///bad.html", "ok\n{{ if }}\n"),
+		call(2, "textDocument/formatting", map[string]any{"textDocument": doc("file:///a.html")}),
+		call(3, "textDocument/documentSymbol", map[string]any{"textDocument": doc("file:///b.html")}),
+		call(4, "textDocument/definition", map[string]any{"textDocument": doc("file:///a.html"), "position": map[string]any{"line": 2, "character": 5}}),
+		call(5, "textDocument/rangeFormatting", map[string]any{"textDocument": doc("file:///a.html"), "range": map[string]any{"start": map[string]any{"line": 1, "character": 0}, "end": map[string]any{"line": 2, "character": 0}}}),
+		call(6, "textDocument/hover", map[string]any{}),
+		call(7, "shutdown", nil),
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+	want := []string{
+		`"documentFormattingProvider":true`,
+		`{"diagnostics":[],"uri":"file:///a.html"}`,
+		`{"diagnostics":[],"uri":"file:///b.html"}`,
+		`{"diagnostics":[{"message":"missing value for if","range":{"end":{"character":8,"line":1},"start":{"character":0,"line":1}},"severity":1,"source":"gohtmlfmt"}],"uri":"file:///bad.html"}`,
+		`"result":[{"newText":" ","range":{"end":{"character":2,"line":0},"start":{"character":2,"line":0}}},{"newText":" ","range":{"end":{"character":15,"line":0},"start":{"character":15,"line":0}}},{"newText":" ","range":{"end":{"character":5,"line":1},"start":{"character":5,"line":1}}},{"newText":" ","range":{"end":{"character":7,"line":1},"start":{"character":7,"line":1}}},{"newText":" ","range":{"end":{"character":2,"line":2},"start":{"character":2,"line":2}}},{"newText":" ","range":{"end":{"character":18,"line":2},"start":{"character":18,"line":2}}},{"newText":" ","range":{"end":{"character":2,"line":3},"start":{"character":2,"line":3}}},{"newText":" ","range":{"end":{"character":5,"line":3},"start":{"character":5,"line":3}}}]`,
+		`"result":[{"children":[{"detail":"block","kind":12,"name":"cell","range":{"end":{"character":55,"line":0},"start":{"character":22,"line":0}},"selectionRange":{"end":{"character":37,"line":0},"start":{"character":31,"line":0}}}],"detail":"define","kind":12,"name":"row","range":{"end":{"character":69,"line":0},"start":{"character":0,"line":0}},"selectionRange":{"end":{"character":15,"line":0},"start":{"character":10,"line":0}}}]`,
+		`"result":[{"range":{"end":{"character":15,"line":0},"start":{"character":10,"line":0}},"uri":"file:///b.html"}]`,
+		`"result":[{"newText":"{{ .A }}","range":{"end":{"character":9,"line":1},"start":{"character":3,"line":1}}}]`,
+		`"error":{"code":-32601,"message":"method not found: textDocument/hover"}`,
+		`"result":null`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d messages, want %d:\n%v", len(got), len(want), got)
+	}
+	for i, m := range got {
+		if s := jsonString(m); !strings.Contains(s, want[i]) {
+			t.Errorf("message %d = %s\nwant it to contain %s", i, s, want[i])
+		}
+	}
+}
+
+func TestPosition(t *testing.T) {
+	d := newDocument("", "a\n€𝄞x\n")
+	for _, tt := range []struct {
+		off int
+		pos Position
+	}{
+		{0, Position{0, 0}},
+		{2, Position{1, 0}},
+		{5, Position{1, 1}},  // after €, 3 bytes, 1 UTF-16 unit
+		{9, Position{1, 3}},  // after 𝄞, 4 bytes, 2 UTF-16 units
+		{10, Position{1, 4}}, // after x
+		{11, Position{2, 0}},
+	} {
+		if got := d.position(tt.off); got != tt.pos {
+			t.Errorf("position(%d) = %v, want %v", tt.off, got, tt.pos)
+		}
+		if got := d.offset(tt.pos); got != tt.off {
+			t.Errorf("offset(%v) = %d, want %d", tt.pos, got, tt.off)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package vet
+
+import (
+	"bufio"
+	"fmt"
+	goast "go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/josharian/gotmplfmt/ast"
+)
+
+// A Func describes the arguments a template function accepts,
+// counting a value piped into the function as its last argument.
+// A nil *Func accepts any arguments.
+type Func struct {
+	MinArgs int
+	MaxArgs int // -1 if there is no maximum
+}
+
+// Builtins holds the functions that text/template and html/template predefine.
+var Builtins = map[string]*Func{
+	"and":      {1, -1},
+	"call":     {1, -1},
+	"eq":       {2, -1},
+	"ge":       {2, 2},
+	"gt":       {2, 2},
+	"html":     {0, -1},
+	"index":    {1, -1},
+	"js":       {0, -1},
+	"le":       {2, 2},
+	"len":      {1, 1},
+	"lt":       {2, 2},
+	"ne":       {2, 2},
+	"not":      {1, 1},
+	"or":       {1, -1},
+	"print":    {0, -1},
+	"printf":   {1, -1},
+	"println":  {0, -1},
+	"slice":    {1, -1},
+	"urlquery": {0, -1},
+}
+
+// FuncSets holds well-known sets of functions by name,
+// without their arguments.
+var FuncSets = map[string][]string{
+	"sprig": sprigFuncs,
+	// Helm's functions are sprig's, except env and expandenv, and its own.
+	"helm": helmFuncs(),
+}
+
+// helmFuncs returns the names of the functions that Helm charts may call.
+func helmFuncs() []string {
+	var funcs []string
+	for _, name := range sprigFuncs {
+		if name != "env" && name != "expandenv" {
+			funcs = append(funcs, name)
+		}
+	}
+	return append(funcs, strings.Fields(`
+		include tpl required lookup toToml fromToml toYaml toYamlPretty fromYaml fromYamlArray
+		toJson fromJson fromJsonArray
+	`)...)
+}
+
+// sprigFuncs holds the names of the functions in github.com/Masterminds/sprig/v3.
+var sprigFuncs = strings.Fields(`
+	hello ago date date_in_zone date_modify dateInZone dateModify duration durationRound
+	htmlDate htmlDateInZone must_date_modify mustDateModify mustToDate now toDate unixEpoch
+	abbrev abbrevboth trunc trim upper lower title untitle substr repeat trimall trimAll
+	trimSuffix trimPrefix nospace initials randAlphaNum randAlpha randAscii randNumeric
+	swapcase shuffle snakecase camelcase kebabcase wrap wrapWith contains hasPrefix hasSuffix
+	quote squote cat indent nindent replace plural sha1sum sha256sum adler32sum toString
+	atoi int64 int float64 seq toDecimal split splitList splitn toStrings until untilStep
+	add1 add sub div mod mul randInt add1f addf subf divf mulf biggest max min maxf minf
+	ceil floor round join sortAlpha default empty coalesce all any compact mustCompact
+	fromJson toJson toPrettyJson toRawJson mustFromJson mustToJson mustToPrettyJson
+	mustToRawJson ternary deepCopy mustDeepCopy typeOf typeIs typeIsLike kindOf kindIs
+	deepEqual env expandenv getHostByName base dir clean ext isAbs osBase osClean osDir
+	osExt osIsAbs b64enc b64dec b32enc b32dec tuple list dict get set unset hasKey pluck
+	keys pick omit merge mergeOverwrite mustMerge mustMergeOverwrite values append push
+	mustAppend mustPush prepend mustPrepend first mustFirst rest mustRest last mustLast
+	initial mustInitial reverse mustReverse uniq mustUniq without mustWithout has mustHas
+	slice mustSlice concat dig chunk mustChunk bcrypt htpasswd genPrivateKey derivePassword
+	buildCustomCert genCA genCAWithKey genSelfSignedCert genSelfSignedCertWithKey
+	genSignedCert genSignedCertWithKey encryptAES decryptAES randBytes uuidv4 semver
+	semverCompare fail regexMatch mustRegexMatch regexFindAll mustRegexFindAll regexFind
+	mustRegexFind regexReplaceAll mustRegexReplaceAll regexReplaceAllLiteral
+	mustRegexReplaceAllLiteral regexSplit mustRegexSplit regexQuoteMeta urlParse urlJoin
+`)
+
+// LoadFuncs returns the builtin functions together with the functions
+// declared by each source, which is one of:
+//
+//   - the name of a set in FuncSets, such as sprig
+//   - a directory holding a Go package, whose exported variables
+//     of type FuncMap are read as by ReadGoFuncs
+//   - a file listing functions, read as by ParseFuncs
+func LoadFuncs(sources []string) (map[string]*Func, error) {
+	funcs := make(map[string]*Func)
+	for name, f := range Builtins {
+		funcs[name] = f
+	}
+	for _, src := range sources {
+		var more map[string]*Func
+		var err error
+		if names, ok := FuncSets[src]; ok {
+			more = make(map[string]*Func)
+			for _, name := range names {
+				more[name] = nil
+			}
+		} else if fi, statErr := os.Stat(src); statErr == nil && fi.IsDir() {
+			more, err = ReadGoFuncs(src)
+		} else {
+			var buf []byte
+			buf, err = os.ReadFile(src)
+			if err == nil {
+				more, err = ParseFuncs(src, string(buf))
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		for name, f := range more {
+			funcs[name] = f
+		}
+	}
+	return funcs, nil
+}
+
+// ParseFuncs parses a list of functions, one per line.
+// Each line holds a function name, optionally followed by the number
+// of arguments it accepts: N for exactly N, or N+ for at least N.
+// Text after a # is a comment. filename is used in error messages.
+//
+//	# Functions from internal/render.
+//	markdown 1
+//	classes 0+
+//	asset
+func ParseFuncs(filename, text string) (map[string]*Func, error) {
+	funcs := make(map[string]*Func)
+	sc := bufio.NewScanner(strings.NewReader(text))
+	for line := 1; sc.Scan(); line++ {
+		s, _, _ := strings.Cut(sc.Text(), "#")
+		f := strings.Fields(s)
+		switch len(f) {
+		case 0:
+			continue
+		case 1:
+			funcs[f[0]] = nil
+			continue
+		case 2:
+			n, variadic := strings.CutSuffix(f[1], "+")
+			min, err := strconv.Atoi(n)
+			if err == nil && min >= 0 {
+				max := min
+				if variadic {
+					max = -1
+				}
+				funcs[f[0]] = &Func{MinArgs: min, MaxArgs: max}
+				continue
+			}
+		}
+		return nil, fmt.Errorf("%s:%d: want a function name and optional argument count, like \"f 1\" or \"f 0+\"", filename, line)
+	}
+	return funcs, sc.Err()
+}
+
+// ReadGoFuncs reads the functions in the exported variables
+// of type FuncMap declared in the Go package in dir, such as
+//
+//	var Funcs = template.FuncMap{
+//		"markdown": markdown,
+//		"upper":    strings.ToUpper,
+//	}
+//
+// It knows the arguments of functions declared in the package
+// and of function literals, but not of functions from other packages.
+func ReadGoFuncs(dir string) (map[string]*Func, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*goast.File
+	decls := make(map[string]*goast.FuncType) // package-level functions
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		for _, d := range f.Decls {
+			if fn, ok := d.(*goast.FuncDecl); ok && fn.Recv == nil {
+				decls[fn.Name.Name] = fn.Type
+			}
+		}
+	}
+	funcs := make(map[string]*Func)
+	found := false
+	for _, f := range files {
+		for _, d := range f.Decls {
+			gen, ok := d.(*goast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*goast.ValueSpec)
+				for i, name := range vs.Names {
+					if !name.IsExported() || i >= len(vs.Values) {
+						continue
+					}
+					lit, ok := vs.Values[i].(*goast.CompositeLit)
+					if !ok || !isFuncMap(lit.Type) && !isFuncMap(vs.Type) {
+						continue
+					}
+					found = true
+					for _, elt := range lit.Elts {
+						kv, ok := elt.(*goast.KeyValueExpr)
+						if !ok {
+							continue
+						}
+						key, ok := kv.Key.(*goast.BasicLit)
+						if !ok || key.Kind != token.STRING {
+							continue
+						}
+						name, err := strconv.Unquote(key.Value)
+						if err != nil {
+							continue
+						}
+						funcs[name] = goFunc(kv.Value, decls)
+					}
+				}
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: no exported FuncMap variables", dir)
+	}
+	return funcs, nil
+}
+
+// isFuncMap reports whether the type expression x names a FuncMap type.
+func isFuncMap(x goast.Expr) bool {
+	switch x := x.(type) {
+	case *goast.Ident:
+		return x.Name == "FuncMap"
+	case *goast.SelectorExpr:
+		return x.Sel.Name == "FuncMap"
+	}
+	return false
+}
+
+// goFunc returns the arguments accepted by the function x,
+// or nil if they are unknown.
+func goFunc(x goast.Expr, decls map[string]*goast.FuncType) *Func {
+	var typ *goast.FuncType
+	switch x := x.(type) {
+	case *goast.Ident:
+		typ = decls[x.Name]
+	case *goast.FuncLit:
+		typ = x.Type
+	}
+	if typ == nil {
+		return nil
+	}
+	f := new(Func)
+	for _, field := range typ.Params.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		f.MinArgs += n
+	}
+	f.MaxArgs = f.MinArgs
+	if params := typ.Params.List; len(params) > 0 {
+		if _, ok := params[len(params)-1].Type.(*goast.Ellipsis); ok {
+			f.MinArgs--
+			f.MaxArgs = -1
+		}
+	}
+	return f
+}
+
+// funcs checks the function calls in the template rooted at root against c.funcs.
+func (c *checker) funcs(root *ast.ListNode) {
+	// The number of arguments passed to each function that heads a command.
+	nargs := make(map[*ast.IdentifierNode]int)
+	ast.Inspect(root, func(n ast.Node) bool {
+		p, ok := n.(*ast.PipeNode)
+		if !ok {
+			return true
+		}
+		for i, cmd := range p.Cmds {
+			if len(cmd.Args) == 0 {
+				continue
+			}
+			if id, ok := cmd.Args[0].(*ast.IdentifierNode); ok {
+				nargs[id] = len(cmd.Args) - 1
+				if i > 0 {
+					nargs[id]++ // the piped value
+				}
+			}
+		}
+		return true
+	})
+	ast.Inspect(root, func(n ast.Node) bool {
+		id, ok := n.(*ast.IdentifierNode)
+		if !ok {
+			return true
+		}
+		args, head := nargs[id]
+		if head && (id.Ident == "template" || id.Ident == "break" || id.Ident == "continue") {
+			return true
+		}
+		f, ok := c.cfg.Funcs[id.Ident]
+		switch {
+		case !ok:
+			c.errorf(id, "function %q not defined", id.Ident)
+		case f == nil:
+		case f.MaxArgs < 0 && args < f.MinArgs:
+			c.errorf(id, "wrong number of args for %s: want at least %d got %d", id.Ident, f.MinArgs, args)
+		case f.MaxArgs >= 0 && (args < f.MinArgs || args > f.MaxArgs):
+			want := strconv.Itoa(f.MinArgs)
+			if f.MaxArgs != f.MinArgs {
+				want += " to " + strconv.Itoa(f.MaxArgs)
+			}
+			c.errorf(id, "wrong number of args for %s: want %s got %d", id.Ident, want, args)
+		}
+		return true
+	})
+}
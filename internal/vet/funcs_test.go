@@ -0,0 +1,106 @@
+package vet
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/josharian/gotmplfmt/ast"
+)
+
+func TestCheckFuncs(t *testing.T) {
+	funcs, err := ParseFuncs("funcs.txt", "# project functions\nmarkdown 1\nclasses 1+  # at least one\nasset\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, f := range Builtins {
+		funcs[name] = f
+	}
+	const src = `{{ lenght .Items }}{{ markdown .A .B }}{{ .A | markdown }}{{ classes }}{{ asset 1 2 3 }}` +
+		`{{ print now }}{{ range . }}{{ break }}{{ end }}{{ template "a" }}{{ len }}{{ eq 1 }}`
+	tree, err := ast.ParseFile("a", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range (&Config{Funcs: funcs}).Check([]*ast.Tree{tree}) {
+		got = append(got, d.String())
+	}
+	want := []string{
+		`a:1:4: function "lenght" not defined`,
+		`a:1:23: wrong number of args for markdown: want 1 got 2`,
+		`a:1:62: wrong number of args for classes: want at least 1 got 0`,
+		`a:1:98: function "now" not defined`,
+		`a:1:158: wrong number of args for len: want 1 got 0`,
+		`a:1:167: wrong number of args for eq: want at least 2 got 1`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check = %q\nwant %q", got, want)
+	}
+}
+
+func TestLoadFuncsHelm(t *testing.T) {
+	funcs, err := LoadFuncs([]string{"helm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"eq", "upper", "include", "toYamlPretty", "fromToml"} {
+		if _, ok := funcs[name]; !ok {
+			t.Errorf("helm lacks %s", name)
+		}
+	}
+	for _, name := range []string{"env", "expandenv"} {
+		if _, ok := funcs[name]; ok {
+			t.Errorf("helm has %s", name)
+		}
+	}
+}
+
+func TestParseFuncsError(t *testing.T) {
+	for _, text := range []string{"f x\n", "f 1 2\n", "f -1\n"} {
+		if _, err := ParseFuncs("funcs.txt", text); err == nil {
+			t.Errorf("ParseFuncs(%q) succeeded, want error", text)
+		}
+	}
+}
+
+func TestReadGoFuncs(t *testing.T) {
+	dir := t.TempDir()
+	const src = `package render
+
+import (
+	"html/template"
+	"strings"
+)
+
+var Funcs = template.FuncMap{
+	"markdown": markdown,
+	"join":     join,
+	"upper":    strings.ToUpper,
+	"pair":     func(a, b any) []any { return []any{a, b} },
+}
+
+var funcs = template.FuncMap{"hidden": markdown}
+
+func markdown(s string) template.HTML { return template.HTML(s) }
+
+func join(sep string, parts ...string) string { return strings.Join(parts, sep) }
+`
+	if err := os.WriteFile(filepath.Join(dir, "render.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadGoFuncs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*Func{
+		"markdown": {1, 1},
+		"join":     {1, -1},
+		"upper":    nil,
+		"pair":     {2, 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadGoFuncs = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,369 @@
+package vet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/josharian/gotmplfmt/ast"
+)
+
+// A Graph is the call graph of a set of templates that are parsed together:
+// which templates each template invokes.
+type Graph struct {
+	// Templates holds every template definition, in order:
+	// the template of each file, followed by the templates defined in it.
+	Templates []*Template
+	byName    map[string]*Template
+}
+
+// A Template is a template definition.
+type Template struct {
+	Name string
+	Kind string // "file" for the template of a whole file, "define", or "block"
+	Tree *ast.Tree
+	// Def is the name in the define or block action,
+	// or nil for the template of a whole file.
+	Def   *ast.StringNode
+	Calls []*Call // in order of appearance
+	empty bool
+}
+
+// A Call is an invocation of a template by a template or block action.
+type Call struct {
+	Name   string
+	Tree   *ast.Tree
+	Pos    ast.Pos   // the position of the name
+	Target *Template // the invoked template, or nil if it is undefined
+}
+
+// Pos returns the position of t's name, or of the start of its file.
+func (t *Template) Pos() ast.Pos {
+	if t.Def == nil {
+		return 0
+	}
+	return t.Def.Position()
+}
+
+// NewGraph returns the call graph of trees.
+// As with template.ParseFiles, the template of each file is named by its base name.
+// When a name is defined more than once, invocations refer to the last
+// definition whose body is not empty, as in text/template,
+// so that a define can override a block in another file.
+func NewGraph(trees []*ast.Tree) *Graph {
+	g := &Graph{byName: make(map[string]*Template)}
+	for _, tree := range trees {
+		file := &Template{Name: path.Base(tree.Name), Kind: "file", Tree: tree, empty: isEmpty(tree.Root)}
+		g.Templates = append(g.Templates, file)
+		g.collect(file, tree.Root)
+	}
+	for _, t := range g.Templates {
+		if g.byName[t.Name] == nil || !t.empty {
+			g.byName[t.Name] = t
+		}
+	}
+	for _, t := range g.Templates {
+		for _, call := range t.Calls {
+			call.Target = g.byName[call.Name]
+		}
+	}
+	return g
+}
+
+// isEmpty reports whether the template body l is empty, as text/template
+// judges it: it holds only space, comments, and the define actions
+// that text/template removes from the body of a file.
+func isEmpty(l *ast.ListNode) bool {
+	for _, n := range l.Nodes {
+		switch n := n.(type) {
+		case *ast.TextNode:
+			if strings.TrimSpace(n.Text) != "" {
+				return false
+			}
+		case *ast.CommentNode:
+		case *ast.BranchNode:
+			if n.Keyword != "define" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// collect records the templates defined in n and the calls that t makes.
+func (g *Graph) collect(t *Template, n ast.Node) {
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ActionNode:
+			if isTemplateCall(n.Pipe) {
+				if name := templateName(n.Pipe, 1); name != nil {
+					t.Calls = append(t.Calls, &Call{Name: name.Text, Tree: t.Tree, Pos: name.Position()})
+				}
+			}
+		case *ast.BranchNode:
+			if n.Keyword != "define" && n.Keyword != "block" {
+				break
+			}
+			name := templateName(n.Pipe, 0)
+			if name == nil {
+				break
+			}
+			if n.Keyword == "block" {
+				t.Calls = append(t.Calls, &Call{Name: name.Text, Tree: t.Tree, Pos: name.Position()})
+			}
+			def := &Template{Name: name.Text, Kind: n.Keyword, Tree: t.Tree, Def: name, empty: isEmpty(n.List)}
+			g.Templates = append(g.Templates, def)
+			g.collect(def, n.List)
+			return false
+		}
+		return true
+	})
+}
+
+// Unused returns the define and block templates that are never invoked,
+// in order of definition. The templates of files are executed by name
+// from Go, so they are never unused.
+func (g *Graph) Unused() []*Template {
+	called := make(map[string]bool)
+	for _, t := range g.Templates {
+		for _, call := range t.Calls {
+			called[call.Name] = true
+		}
+	}
+	var unused []*Template
+	for _, t := range g.Templates {
+		if t.Kind != "file" && !called[t.Name] && g.byName[t.Name] == t {
+			unused = append(unused, t)
+		}
+	}
+	return unused
+}
+
+// Cycles returns the cycles of templates that invoke themselves,
+// directly or indirectly. Each cycle starts and ends with the same template,
+// which is the earliest defined template in the cycle.
+// There is one cycle for each set of templates that invoke one another.
+func (g *Graph) Cycles() [][]*Template {
+	// Tarjan's strongly connected components algorithm.
+	index := make(map[*Template]int)
+	low := make(map[*Template]int)
+	onStack := make(map[*Template]bool)
+	var stack []*Template
+	var sccs [][]*Template
+	var visit func(t *Template)
+	visit = func(t *Template) {
+		index[t] = len(index)
+		low[t] = index[t]
+		stack = append(stack, t)
+		onStack[t] = true
+		for _, call := range t.Calls {
+			u := call.Target
+			if u == nil {
+				continue
+			}
+			if _, ok := index[u]; !ok {
+				visit(u)
+				if low[u] < low[t] {
+					low[t] = low[u]
+				}
+			} else if onStack[u] && index[u] < low[t] {
+				low[t] = index[u]
+			}
+		}
+		if low[t] != index[t] {
+			return
+		}
+		var scc []*Template
+		for {
+			u := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[u] = false
+			scc = append(scc, u)
+			if u == t {
+				break
+			}
+		}
+		sccs = append(sccs, scc)
+	}
+	for _, t := range g.Templates {
+		if _, ok := index[t]; !ok {
+			visit(t)
+		}
+	}
+
+	order := make(map[*Template]int)
+	for i, t := range g.Templates {
+		order[t] = i
+	}
+	var cycles [][]*Template
+	for _, scc := range sccs {
+		in := make(map[*Template]bool)
+		first := scc[0]
+		for _, t := range scc {
+			in[t] = true
+			if order[t] < order[first] {
+				first = t
+			}
+		}
+		if cycle := shortestCycle(first, in); cycle != nil {
+			cycles = append(cycles, cycle)
+		}
+	}
+	// Report cycles in order of definition.
+	for i := 1; i < len(cycles); i++ {
+		for j := i; j > 0 && order[cycles[j][0]] < order[cycles[j-1][0]]; j-- {
+			cycles[j], cycles[j-1] = cycles[j-1], cycles[j]
+		}
+	}
+	return cycles
+}
+
+// shortestCycle returns the shortest path from start back to itself
+// through the templates in in, or nil if there is none.
+func shortestCycle(start *Template, in map[*Template]bool) []*Template {
+	prev := make(map[*Template]*Template)
+	queue := []*Template{start}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		for _, call := range t.Calls {
+			u := call.Target
+			if !in[u] {
+				continue
+			}
+			if u == start {
+				cycle := []*Template{start}
+				for ; t != start; t = prev[t] {
+					cycle = append(cycle, t)
+				}
+				cycle = append(cycle, start)
+				for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+					cycle[i], cycle[j] = cycle[j], cycle[i]
+				}
+				return cycle
+			}
+			if _, seen := prev[u]; !seen {
+				prev[u] = t
+				queue = append(queue, u)
+			}
+		}
+	}
+	return nil
+}
+
+// WriteDOT writes g to w in the Graphviz DOT language.
+// File templates are boxes, and undefined templates are dashed.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph templates {\n")
+	for _, t := range g.Templates {
+		if g.byName[t.Name] != t {
+			continue
+		}
+		if t.Kind == "file" {
+			fmt.Fprintf(&b, "\t%q [shape=box];\n", t.Name)
+		} else {
+			fmt.Fprintf(&b, "\t%q;\n", t.Name)
+		}
+	}
+	undefined := make(map[string]bool)
+	for _, t := range g.Templates {
+		for _, call := range t.Calls {
+			if call.Target == nil && !undefined[call.Name] {
+				undefined[call.Name] = true
+				fmt.Fprintf(&b, "\t%q [style=dashed];\n", call.Name)
+			}
+		}
+	}
+	edges := make(map[[2]string]bool)
+	for _, t := range g.Templates {
+		for _, call := range t.Calls {
+			if edge := [2]string{t.Name, call.Name}; !edges[edge] {
+				edges[edge] = true
+				fmt.Fprintf(&b, "\t%q -> %q;\n", t.Name, call.Name)
+			}
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// A jsonTemplate is the description of a template written by WriteJSON.
+type jsonTemplate struct {
+	Name  string     `json:"name"`
+	Kind  string     `json:"kind"`
+	Pos   string     `json:"pos"`
+	Calls []jsonCall `json:"calls"`
+}
+
+type jsonCall struct {
+	Name    string `json:"name"`
+	Pos     string `json:"pos"`
+	Defined bool   `json:"defined"`
+}
+
+// WriteJSON writes g to w as a JSON array of templates,
+// each with its name, kind, position, and calls.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	out := []jsonTemplate{}
+	for _, t := range g.Templates {
+		jt := jsonTemplate{Name: t.Name, Kind: t.Kind, Pos: position(t.Tree, t.Pos()), Calls: []jsonCall{}}
+		for _, call := range t.Calls {
+			jt.Calls = append(jt.Calls, jsonCall{Name: call.Name, Pos: position(call.Tree, call.Pos), Defined: call.Target != nil})
+		}
+		out = append(out, jt)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(out)
+}
+
+// Check returns the problems in g: invocations of undefined templates,
+// templates defined more than once by define actions, and unused templates.
+// A define that overrides a block is not a redefinition,
+// nor is a definition with an empty body.
+func (g *Graph) Check() []Diagnostic {
+	var diags []Diagnostic
+	defined := make(map[string]*Template)
+	for _, t := range g.Templates {
+		if t.Kind == "define" && !t.empty {
+			if prev := defined[t.Name]; prev != nil {
+				diags = append(diags, diagnostic(t.Tree, t.Pos(), "template %q redefined; previous definition at %s", t.Name, position(prev.Tree, prev.Pos())))
+			}
+			defined[t.Name] = t
+		}
+		for _, call := range t.Calls {
+			if call.Target == nil {
+				diags = append(diags, diagnostic(call.Tree, call.Pos, "no such template %q", call.Name))
+			}
+		}
+	}
+	for _, t := range g.Unused() {
+		diags = append(diags, diagnostic(t.Tree, t.Pos(), "template %q is never invoked", t.Name))
+	}
+	return diags
+}
+
+// CheckCycles returns a problem for each of g's cycles.
+// Recursive templates are legal, so Check does not report them.
+func (g *Graph) CheckCycles() []Diagnostic {
+	var diags []Diagnostic
+	for _, cycle := range g.Cycles() {
+		names := make([]string, len(cycle))
+		for i, t := range cycle {
+			names[i] = strconv.Quote(t.Name)
+		}
+		diags = append(diags, diagnostic(cycle[0].Tree, cycle[0].Pos(), "template %q invokes itself: %s", cycle[0].Name, strings.Join(names, " -> ")))
+	}
+	return diags
+}
+
+func diagnostic(tree *ast.Tree, pos ast.Pos, format string, args ...any) Diagnostic {
+	return Diagnostic{Tree: tree, Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,99 @@
+package vet
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/josharian/gotmplfmt/ast"
+)
+
+func parseSet(t *testing.T, files ...string) []*ast.Tree {
+	t.Helper()
+	var trees []*ast.Tree
+	for i := 0; i < len(files); i += 2 {
+		tree, err := ast.ParseFile(files[i], files[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		trees = append(trees, tree)
+	}
+	return trees
+}
+
+func TestGraph(t *testing.T) {
+	g := NewGraph(parseSet(t,
+		"dir/page.html", `{{ template "row" . }}{{ template "nope" }}{{ block "side" . }}{{ template "page.html" }}{{ end }}`,
+		"rows.html", `{{ define "row" }}{{ template "cell" }}{{ template "cell" }}{{ end }}{{ define "cell" }}{{ template "row" }}{{ end }}{{ define "unused" }}{{ end }}`,
+	))
+
+	var dot bytes.Buffer
+	if err := g.WriteDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	const wantDOT = `digraph templates {
+	"page.html" [shape=box];
+	"side";
+	"rows.html" [shape=box];
+	"row";
+	"cell";
+	"unused";
+	"nope" [style=dashed];
+	"page.html" -> "row";
+	"page.html" -> "nope";
+	"page.html" -> "side";
+	"side" -> "page.html";
+	"row" -> "cell";
+	"cell" -> "row";
+}
+`
+	if dot.String() != wantDOT {
+		t.Errorf("WriteDOT wrote\n%s\nwant\n%s", dot.String(), wantDOT)
+	}
+
+	var got []string
+	for _, d := range append(g.Check(), g.CheckCycles()...) {
+		got = append(got, d.String())
+	}
+	want := []string{
+		`dir/page.html:1:35: no such template "nope"`,
+		`rows.html:1:128: template "unused" is never invoked`,
+		`dir/page.html:1:1: template "page.html" invokes itself: "page.html" -> "side" -> "page.html"`,
+		`rows.html:1:11: template "row" invokes itself: "row" -> "cell" -> "row"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check = %q\nwant %q", got, want)
+	}
+}
+
+func TestGraphJSON(t *testing.T) {
+	g := NewGraph(parseSet(t, "a.html", `{{ define "x" }}{{ template "y" }}{{ end }}`))
+	var buf bytes.Buffer
+	if err := g.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const want = `[
+	{
+		"name": "a.html",
+		"kind": "file",
+		"pos": "a.html:1:1",
+		"calls": []
+	},
+	{
+		"name": "x",
+		"kind": "define",
+		"pos": "a.html:1:11",
+		"calls": [
+			{
+				"name": "y",
+				"pos": "a.html:1:29",
+				"defined": false
+			}
+		]
+	}
+]
+`
+	if buf.String() != want {
+		t.Errorf("WriteJSON wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+}
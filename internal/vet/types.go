@@ -0,0 +1,299 @@
+package vet
+
+import (
+	"fmt"
+	"go/types"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/josharian/gotmplfmt/ast"
+)
+
+// A typeChecker checks the field and method references in one template file
+// against the types of dot and of variables.
+type typeChecker struct {
+	*checker
+	res    *ast.Resolution
+	vars   map[*ast.VariableNode]types.Type // the types of declared variables
+	dollar types.Type                       // the type of $
+	// mixed holds the declared variables that are assigned values
+	// of a type other than their declared type, and so have no known type.
+	mixed map[*ast.VariableNode]bool
+}
+
+// types checks the field references in the template rooted at root.
+// The type of dot comes from gotmplfmt:type directives and from c.cfg.Types.
+func (c *checker) types(root *ast.ListNode) {
+	tc := &typeChecker{
+		checker: c,
+		res:     ast.Resolve(root),
+		vars:    make(map[*ast.VariableNode]types.Type),
+		mixed:   make(map[*ast.VariableNode]bool),
+	}
+	var dot types.Type
+	patterns := make([]string, 0, len(c.cfg.Types))
+	for pattern := range c.cfg.Types {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, path.Base(c.tree.Name)); ok {
+			dot = tc.load(c.cfg.Types[pattern], root)
+			break
+		}
+	}
+	// The first pass finds the variables with mixed types,
+	// which may be used before they are assigned, as in the body of a range.
+	n := len(c.diags)
+	tc.template(root, dot)
+	c.diags = c.diags[:n]
+	tc.template(root, dot)
+}
+
+// load returns the type named by spec, reporting an error at n if there is none.
+func (tc *typeChecker) load(spec string, n ast.Node) types.Type {
+	t, err := lookupType(tc.cfg.Importer, spec)
+	if err != nil {
+		tc.errorf(n, "%v", err)
+		return nil
+	}
+	return t
+}
+
+// lookupType returns the type named by spec, which has the form
+// import/path.Name, optionally preceded by a * for a pointer.
+func lookupType(imp types.Importer, spec string) (types.Type, error) {
+	name, ptr := strings.CutPrefix(spec, "*")
+	i := strings.LastIndex(name, ".")
+	if i < 0 || strings.LastIndex(name, "/") > i {
+		return nil, fmt.Errorf("invalid type %q: want import/path.Name", spec)
+	}
+	pkg, err := imp.Import(name[:i])
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := pkg.Scope().Lookup(name[i+1:]).(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("%s.%s is not a type", pkg.Path(), name[i+1:])
+	}
+	t := obj.Type()
+	if ptr {
+		t = types.NewPointer(t)
+	}
+	return t, nil
+}
+
+// template checks the body of a template in which dot has type dot.
+// A nil type is unknown and disables checking.
+func (tc *typeChecker) template(l *ast.ListNode, dot types.Type) {
+	if spec, directive := ast.DotType(l); directive != nil {
+		dot = tc.load(spec, directive)
+	}
+	outer := tc.dollar
+	tc.dollar = dot
+	tc.list(l, dot)
+	tc.dollar = outer
+}
+
+func (tc *typeChecker) list(l *ast.ListNode, dot types.Type) {
+	if l == nil {
+		return
+	}
+	for _, n := range l.Nodes {
+		switch n := n.(type) {
+		case *ast.ActionNode:
+			tc.pipe(n.Pipe, dot)
+		case *ast.BranchNode:
+			tc.branch(n, dot)
+		}
+	}
+}
+
+func (tc *typeChecker) branch(b *ast.BranchNode, dot types.Type) {
+	body := dot
+	switch b.Keyword {
+	case "define":
+		tc.template(b.List, nil)
+		return
+	case "block":
+		tc.pipe(b.Pipe, dot)
+		var arg types.Type
+		if cmds := b.Pipe.Cmds; len(cmds) == 1 && len(cmds[0].Args) == 2 {
+			arg = tc.arg(cmds[0].Args[1], dot)
+		}
+		tc.template(b.List, arg)
+		return
+	case "with":
+		body = tc.pipe(b.Pipe, dot)
+	case "range":
+		t := tc.pipe(b.Pipe, dot)
+		key, elem := rangeTypes(t)
+		body = elem
+		if decl := b.Pipe.Decl; !b.Pipe.IsAssign {
+			switch len(decl) {
+			case 1:
+				tc.declare(decl[0], elem)
+			case 2:
+				tc.declare(decl[0], key)
+				tc.declare(decl[1], elem)
+			}
+		}
+	default:
+		tc.pipe(b.Pipe, dot)
+	}
+	tc.list(b.List, body)
+	// Only else if has a pipeline, which sees the outer dot, as do all the else branches.
+	for _, e := range b.Elses {
+		if e.Pipe != nil {
+			tc.pipe(e.Pipe, dot)
+		}
+		tc.list(e.List, dot)
+	}
+}
+
+// pipe checks p and returns the type of its value, or nil if it is unknown.
+// It records the types of the variables p declares.
+func (tc *typeChecker) pipe(p *ast.PipeNode, dot types.Type) types.Type {
+	if p == nil {
+		return nil
+	}
+	var t types.Type
+	for _, cmd := range p.Cmds {
+		for i, arg := range cmd.Args {
+			// The type of a command is that of its first operand,
+			// such as a field or a method called with arguments,
+			// and unknown for a function.
+			if at := tc.arg(arg, dot); i == 0 {
+				t = at
+			}
+		}
+	}
+	for _, v := range p.Decl {
+		if !p.IsAssign {
+			tc.declare(v, t)
+			continue
+		}
+		if decl := tc.res.Decls[v]; decl != nil && !identical(tc.vars[decl], t) {
+			tc.mixed[decl] = true
+			tc.vars[decl] = nil
+		}
+	}
+	return t
+}
+
+// declare records that the variable v is declared with type t.
+func (tc *typeChecker) declare(v *ast.VariableNode, t types.Type) {
+	if tc.mixed[v] {
+		t = nil
+	}
+	tc.vars[v] = t
+}
+
+// identical reports whether t and u are the same type,
+// treating unknown types as different from all others.
+func identical(t, u types.Type) bool {
+	return t != nil && u != nil && types.Identical(t, u)
+}
+
+// arg checks arg and returns its type, or nil if it is unknown.
+func (tc *typeChecker) arg(arg ast.Node, dot types.Type) types.Type {
+	switch arg := arg.(type) {
+	case *ast.DotNode:
+		return dot
+	case *ast.FieldNode:
+		return tc.fields(arg, dot, arg.Ident)
+	case *ast.VariableNode:
+		t := tc.dollar
+		if arg.Ident[0] != "$" {
+			t = tc.vars[tc.res.Decls[arg]]
+		}
+		return tc.fields(arg, t, arg.Ident[1:])
+	case *ast.ChainNode:
+		return tc.fields(arg, tc.arg(arg.Node, dot), arg.Field)
+	case *ast.PipeNode:
+		return tc.pipe(arg, dot)
+	}
+	return nil
+}
+
+// fields returns the type of the chain of field and method names applied to t,
+// reporting an error at n for a name that does not exist.
+func (tc *typeChecker) fields(n ast.Node, t types.Type, names []string) types.Type {
+	for _, name := range names {
+		if t == nil {
+			return nil
+		}
+		next, ok := lookupField(t, name)
+		if !ok {
+			tc.errorf(n, "can't evaluate field %s in type %s", name, types.TypeString(t, (*types.Package).Name))
+			return nil
+		}
+		t = next
+	}
+	return t
+}
+
+// lookupField returns the type of the field, method result, or map element
+// that .name selects from a value of type t. The type is nil if it is unknown,
+// as for a method of an interface.
+// lookupField reports whether t may have such a field.
+func lookupField(t types.Type, name string) (types.Type, bool) {
+	u := t.Underlying()
+	if p, ok := u.(*types.Pointer); ok {
+		u = p.Elem().Underlying()
+	}
+	switch u := u.(type) {
+	case *types.Interface:
+		// The dynamic type may have any field.
+		if obj, _, _ := types.LookupFieldOrMethod(t, true, nil, name); obj != nil {
+			return result(obj.(*types.Func)), true
+		}
+		return nil, true
+	case *types.Map:
+		// As in text/template, the name must be assignable to the key type.
+		if types.AssignableTo(types.Typ[types.String], u.Key()) {
+			return u.Elem(), true
+		}
+	case *types.TypeParam:
+		return nil, true
+	}
+	obj, _, _ := types.LookupFieldOrMethod(t, true, nil, name)
+	switch obj := obj.(type) {
+	case *types.Var:
+		return obj.Type(), true
+	case *types.Func:
+		return result(obj), true
+	}
+	return nil, false
+}
+
+// result returns the type of the first result of f, or nil if there is none.
+func result(f *types.Func) types.Type {
+	if res := f.Type().(*types.Signature).Results(); res.Len() > 0 {
+		return res.At(0).Type()
+	}
+	return nil
+}
+
+// rangeTypes returns the types of the keys and elements of a range over a value of type t.
+func rangeTypes(t types.Type) (key, elem types.Type) {
+	if t == nil {
+		return nil, nil
+	}
+	u := t.Underlying()
+	if p, ok := u.(*types.Pointer); ok {
+		u = p.Elem().Underlying()
+	}
+	switch u := u.(type) {
+	case *types.Slice:
+		return types.Typ[types.Int], u.Elem()
+	case *types.Array:
+		return types.Typ[types.Int], u.Elem()
+	case *types.Map:
+		return u.Key(), u.Elem()
+	case *types.Chan:
+		return u.Elem(), u.Elem()
+	}
+	return nil, nil
+}
@@ -0,0 +1,127 @@
+package vet
+
+import (
+	"fmt"
+	goast "go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"testing"
+
+	"github.com/josharian/gotmplfmt/ast"
+)
+
+const webSrc = `package web
+
+type PageData struct {
+	Title string
+	User  *User
+	Items []Item
+	Meta  map[string]Item
+	Any   any
+	Keyed map[Key]Item
+}
+
+type Key string
+
+type User struct{ Name string }
+
+func (u *User) Initials() string { return u.Name[:1] }
+
+func (p PageData) Find(id int) Item { return p.Items[id] }
+
+type Item struct{ ID int; Label string }
+`
+
+// sourceImporter imports packages from source text, keyed by import path.
+type sourceImporter map[string]string
+
+func (imp sourceImporter) Import(path string) (*types.Package, error) {
+	src, ok := imp[path]
+	if !ok {
+		return nil, fmt.Errorf("can't find package %q", path)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path+".go", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	return new(types.Config).Check(path, fset, []*goast.File{f}, nil)
+}
+
+func TestCheckTypes(t *testing.T) {
+	const src = `{{/* gotmplfmt:type example.com/web.PageData */}}` +
+		`{{ .Title }}{{ .Titel }}{{ .User.Initials }}{{ .User.Nmae }}` +
+		`{{ range $i, $it := .Items }}{{ .Label }}{{ $it.ID }}{{ $.Title }}{{ .Title }}{{ end }}` +
+		`{{ with .User }}{{ .Name }}{{ else }}{{ .Name }}{{ end }}` +
+		`{{ (.Find 1).Lable }}{{ .Meta.anything.ID }}{{ .Any.Whatever }}{{ $u := .User }}{{ $u.Age }}` +
+		`{{ define "row" }}{{ .Unknown }}{{ end }}{{ template "row" }}` +
+		`{{ define "item" }}{{/* gotmplfmt:type *example.com/web.Item */}}{{ .Label }}{{ .Title }}{{ end }}{{ template "item" }}`
+	tree, err := ast.ParseFile("page.html", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{Importer: sourceImporter{"example.com/web": webSrc}}
+	var got []string
+	for _, d := range cfg.Check([]*ast.Tree{tree}) {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"page.html:1:65: can't evaluate field Titel in type web.PageData",
+		"page.html:1:97: can't evaluate field Nmae in type *web.User",
+		"page.html:1:179: can't evaluate field Title in type web.Item",
+		"page.html:1:237: can't evaluate field Name in type web.PageData",
+		"page.html:1:257: can't evaluate field Lable in type web.Item",
+		"page.html:1:337: can't evaluate field Age in type *web.User",
+		"page.html:1:487: can't evaluate field Title in type *web.Item",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check = %q\nwant %q", got, want)
+	}
+}
+
+func TestCheckTypesAssign(t *testing.T) {
+	const src = `{{/* gotmplfmt:type example.com/web.PageData */}}` +
+		`{{ $u := .User }}{{ range .Items }}{{ $u.Label }}{{ $u = . }}{{ end }}` +
+		`{{ $t := .Title }}{{ $t = .Title }}{{ $t.X }}{{ .Keyed.a }}`
+	tree, err := ast.ParseFile("page.html", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{Importer: sourceImporter{"example.com/web": webSrc}}
+	var got []string
+	for _, d := range cfg.Check([]*ast.Tree{tree}) {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"page.html:1:158: can't evaluate field X in type string",
+		"page.html:1:168: can't evaluate field a in type map[web.Key]web.Item",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check = %q\nwant %q", got, want)
+	}
+}
+
+func TestCheckTypesConfig(t *testing.T) {
+	const src = `{{ .Name }}{{ .Nope }}{{ define "x" }}{{/* gotmplfmt:type example.com/web.Missing */}}{{ .Y }}{{ end }}{{ template "x" }}`
+	tree, err := ast.ParseFile("dir/user.html", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		Importer: sourceImporter{"example.com/web": webSrc},
+		Types:    map[string]string{"*.txt": "example.com/web.Item", "user.*": "example.com/web.User"},
+	}
+	var got []string
+	for _, d := range cfg.Check([]*ast.Tree{tree}) {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"dir/user.html:1:15: can't evaluate field Nope in type web.User",
+		"dir/user.html:1:39: example.com/web.Missing is not a type",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check = %q\nwant %q", got, want)
+	}
+}
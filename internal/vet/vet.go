@@ -0,0 +1,170 @@
+// Package vet reports suspicious constructs in sets of templates.
+package vet
+
+import (
+	"fmt"
+	"go/types"
+	"sort"
+
+	"github.com/josharian/gotmplfmt/ast"
+)
+
+// A Diagnostic is a problem found in a template.
+type Diagnostic struct {
+	Tree    *ast.Tree
+	Pos     ast.Pos
+	Message string
+}
+
+// String returns d in the form file:line:col: message.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", position(d.Tree, d.Pos), d.Message)
+}
+
+func position(t *ast.Tree, p ast.Pos) string {
+	line, col := t.LineCol(p)
+	return fmt.Sprintf("%s:%d:%d", t.Name, line, col)
+}
+
+// A Config controls which checks Check performs.
+type Config struct {
+	// Funcs holds the functions that templates may call.
+	// If nil, function calls are not checked.
+	Funcs map[string]*Func
+	// Importer loads the packages that declare the types of dot,
+	// which are named by gotmplfmt:type directives and by Types.
+	// If nil, field and method references are not checked.
+	Importer types.Importer
+	// Types maps patterns, matched against the base names
+	// of template files as by path.Match, to the type of dot in those files.
+	// Types are written as import/path.Name, optionally preceded by *.
+	// A gotmplfmt:type directive in a file overrides Types.
+	Types map[string]string
+}
+
+// Check checks a set of templates using the default configuration.
+func Check(trees []*ast.Tree) []Diagnostic {
+	return new(Config).Check(trees)
+}
+
+// Check checks a set of templates that are parsed together,
+// as by template.ParseFiles or ParseFS, and returns the problems it finds,
+// ordered by tree and then by position. It reports:
+//
+//   - variables declared with := and never used
+//   - uses of, and = assignments to, undeclared variables
+//   - variable declarations that shadow a variable in an enclosing scope
+//   - templates defined and never invoked by a template or block action
+//   - template actions that invoke templates that are not defined
+//   - templates defined more than once by define actions
+//   - calls of functions not in cfg.Funcs, or with the wrong number of arguments
+//   - references to fields and methods that the type of dot or of a variable lacks
+//
+// Each file also defines a template named by its base name,
+// which template actions may invoke.
+func (cfg *Config) Check(trees []*ast.Tree) []Diagnostic {
+	c := &checker{cfg: cfg, trees: trees}
+	for _, t := range trees {
+		c.tree = t
+		c.variables(t.Root)
+		if cfg.Funcs != nil {
+			c.funcs(t.Root)
+		}
+		if cfg.Importer != nil {
+			c.types(t.Root)
+		}
+	}
+	c.diags = append(c.diags, NewGraph(trees).Check()...)
+	sort.SliceStable(c.diags, func(i, j int) bool {
+		return c.index(c.diags[i].Tree) < c.index(c.diags[j].Tree) ||
+			c.diags[i].Tree == c.diags[j].Tree && c.diags[i].Pos < c.diags[j].Pos
+	})
+	return c.diags
+}
+
+type checker struct {
+	cfg   *Config
+	tree  *ast.Tree
+	diags []Diagnostic
+	trees []*ast.Tree
+}
+
+func (c *checker) errorf(n ast.Node, format string, args ...any) {
+	c.diags = append(c.diags, Diagnostic{Tree: c.tree, Pos: n.Position(), Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) index(t *ast.Tree) int {
+	for i, u := range c.trees {
+		if u == t {
+			return i
+		}
+	}
+	return len(c.trees)
+}
+
+// variables checks the variables in the template rooted at root.
+func (c *checker) variables(root *ast.ListNode) {
+	var decls []*ast.VariableNode
+	assigned := make(map[*ast.VariableNode]bool)
+	// exempt variables are never reported as unused,
+	// such as the key in {{ range $k, $v := . }}, which is needed to name the value.
+	exempt := make(map[*ast.VariableNode]bool)
+	ast.Inspect(root, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.PipeNode:
+			for _, v := range n.Decl {
+				if n.IsAssign {
+					assigned[v] = true
+				} else {
+					decls = append(decls, v)
+				}
+			}
+		case *ast.BranchNode:
+			if n.Keyword == "range" && len(n.Pipe.Decl) == 2 && !n.Pipe.IsAssign {
+				exempt[n.Pipe.Decl[0]] = true
+			}
+		}
+		return true
+	})
+	res := ast.Resolve(root)
+	used := make(map[*ast.VariableNode]bool)
+	for ref, decl := range res.Decls {
+		if !assigned[ref] {
+			used[decl] = true
+		}
+	}
+	for _, v := range res.Undeclared {
+		if assigned[v] {
+			c.errorf(v, "assignment to undeclared variable %s", v.Ident[0])
+		} else {
+			c.errorf(v, "undefined variable %s", v.Ident[0])
+		}
+	}
+	for _, v := range decls {
+		if !used[v] && !exempt[v] {
+			c.errorf(v, "%s declared and not used", v.Ident[0])
+		}
+		if prev := res.Shadows[v]; prev != nil {
+			c.errorf(v, "declaration of %s shadows declaration at %s", v.Ident[0], position(c.tree, prev.Position()))
+		}
+	}
+}
+
+// isTemplateCall reports whether p is the pipeline of a template action.
+func isTemplateCall(p *ast.PipeNode) bool {
+	if p == nil || len(p.Cmds) != 1 || len(p.Cmds[0].Args) == 0 {
+		return false
+	}
+	id, ok := p.Cmds[0].Args[0].(*ast.IdentifierNode)
+	return ok && id.Ident == "template"
+}
+
+// templateName returns the string argument at index i of the sole command in p,
+// which names a template in define, block, and template actions.
+func templateName(p *ast.PipeNode, i int) *ast.StringNode {
+	if p == nil || len(p.Cmds) != 1 || len(p.Cmds[0].Args) <= i {
+		return nil
+	}
+	s, _ := p.Cmds[0].Args[i].(*ast.StringNode)
+	return s
+}
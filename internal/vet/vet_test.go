@@ -0,0 +1,104 @@
+package vet
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/josharian/gotmplfmt/ast"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string // in the order listed in names
+		names []string
+		want  []string
+	}{
+		{
+			name:  "variables",
+			names: []string{"a"},
+			files: map[string]string{
+				"a": `{{ $x := 1 }}{{ $y := 2 }}{{ $y }}{{ $z = 3 }}{{ $w }}{{ $.A }}`,
+			},
+			want: []string{
+				"a:1:4: $x declared and not used",
+				"a:1:38: assignment to undeclared variable $z",
+				"a:1:50: undefined variable $w",
+			},
+		},
+		{
+			name:  "scopes",
+			names: []string{"a"},
+			files: map[string]string{
+				"a": `{{ $x := 1 }}{{ if $y := .A }}{{ $z := $x }}{{ else }}{{ $y }}{{ $z }}{{ end }}{{ $y }}` +
+					`{{ define "t" }}{{ $x }}{{ end }}{{ template "t" }}`,
+			},
+			want: []string{
+				"a:1:34: $z declared and not used",
+				"a:1:66: undefined variable $z",
+				"a:1:83: undefined variable $y",
+				"a:1:107: undefined variable $x",
+			},
+		},
+		{
+			name:  "shadow",
+			names: []string{"a"},
+			files: map[string]string{
+				"a": `{{ $x := 1 }}{{ if $x }}{{ $x := 2 }}{{ $x }}{{ end }}`,
+			},
+			want: []string{
+				"a:1:28: declaration of $x shadows declaration at a:1:4",
+			},
+		},
+		{
+			name:  "range",
+			names: []string{"a"},
+			files: map[string]string{
+				"a": `{{ range $i, $e := . }}{{ $e }}{{ end }}{{ range $v := . }}{{ end }}{{ $a := 1 }}{{ $a = 2 }}{{ $a }}`,
+			},
+			want: []string{
+				"a:1:50: $v declared and not used",
+			},
+		},
+		{
+			name:  "templates",
+			names: []string{"dir/a.html", "b.html"},
+			files: map[string]string{
+				"dir/a.html": `{{ define "x" }}x{{ end }}{{ define "y" }}{{ end }}{{ template "z" }}{{ template "b.html" }}{{ block "w" . }}{{ end }}`,
+				"b.html":     `{{ define "x" }}x{{ end }}{{ define "w" }}{{ end }}{{ template "x" }}{{ template "a.html" }}`,
+			},
+			want: []string{
+				`dir/a.html:1:37: template "y" is never invoked`,
+				`dir/a.html:1:64: no such template "z"`,
+				`b.html:1:11: template "x" redefined; previous definition at dir/a.html:1:11`,
+			},
+		},
+		{
+			name:  "block-override",
+			names: []string{"layout.html", "page.html"},
+			files: map[string]string{
+				"layout.html": `{{ block "content" . }}default{{ end }}`,
+				"page.html":   `{{ define "content" }}{{ template "row" }}{{ end }}{{ define "row" }}{{ end }}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var trees []*ast.Tree
+			for _, name := range tt.names {
+				tree, err := ast.ParseFile(name, tt.files[name])
+				if err != nil {
+					t.Fatal(err)
+				}
+				trees = append(trees, tree)
+			}
+			var got []string
+			for _, d := range Check(trees) {
+				got = append(got, d.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
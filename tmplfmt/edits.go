@@ -0,0 +1,180 @@
+package tmplfmt
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// FormatEdits formats src using the default options
+// and returns the changes as edits.
+func FormatEdits(src string) ([]Edit, error) {
+	return Options{}.FormatEdits(src)
+}
+
+// FormatEdits formats src using opts and returns the changes as edits,
+// in increasing offset order, rather than as a new document.
+// The edits are minimal at the granularity of tokens:
+// words, runs of whitespace, and single punctuation characters.
+// Text that formatting leaves alone is never inside an edit,
+// so editors can keep cursors and marks in place.
+func (opts Options) FormatEdits(src string) ([]Edit, error) {
+	out, err := opts.Format(src)
+	if err != nil {
+		return nil, err
+	}
+	return diff(src, out), nil
+}
+
+// diff returns minimal token edits that turn a into b.
+func diff(a, b string) []Edit {
+	if a == b {
+		return nil
+	}
+	// Trim the common prefix and suffix, which is typically most of the text,
+	// before diffing the tokens of the rest.
+	at, bt := tokens(a), tokens(b)
+	pre := 0
+	for pre < len(at) && pre < len(bt) && at[pre] == bt[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(at)-pre && suf < len(bt)-pre && at[len(at)-1-suf] == bt[len(bt)-1-suf] {
+		suf++
+	}
+	off := 0
+	for _, t := range at[:pre] {
+		off += len(t)
+	}
+	var edits []Edit
+	var cur *Edit
+	for _, op := range myers(at[pre:len(at)-suf], bt[pre:len(bt)-suf]) {
+		if op.kind == opEqual {
+			cur = nil
+			off += len(op.text)
+			continue
+		}
+		if cur == nil {
+			edits = append(edits, Edit{Offset: off})
+			cur = &edits[len(edits)-1]
+		}
+		if op.kind == opDelete {
+			cur.Length += len(op.text)
+			off += len(op.text)
+		} else {
+			cur.NewText += op.text
+		}
+	}
+	return edits
+}
+
+// tokens splits s into words, runs of whitespace, and other single characters.
+func tokens(s string) []string {
+	var toks []string
+	for len(s) > 0 {
+		r, n := utf8.DecodeRuneInString(s)
+		if class := tokenClass(r); class != 0 {
+			for n < len(s) {
+				r, size := utf8.DecodeRuneInString(s[n:])
+				if tokenClass(r) != class {
+					break
+				}
+				n += size
+			}
+		}
+		toks = append(toks, s[:n])
+		s = s[n:]
+	}
+	return toks
+}
+
+// tokenClass returns 1 for space, 2 for word characters, and 0 otherwise.
+func tokenClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 1
+	case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return 2
+	}
+	return 0
+}
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type diffOp struct {
+	kind opKind
+	text string
+}
+
+// myers returns a shortest sequence of operations turning a into b,
+// using the algorithm from Myers, "An O(ND) Difference Algorithm and Its Variations".
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	// v[max+k] is the furthest x reached on diagonal k.
+	// trace[d] holds v[max-d : max+d+1] after d edits.
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	for d, done := 0, false; !done; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[max+k-1] < v[max+k+1] {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			done = done || x >= n && y >= m
+		}
+		trace = append(trace, append([]int(nil), v[max-d:max+d+1]...))
+	}
+
+	// Walk back from (n, m) to recover the operations, last first.
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1] // prev[d-1+k] is the furthest x on diagonal k
+		k := x - y
+		var pk int
+		if k == -d || k != d && prev[d-1+k-1] < prev[d-1+k+1] {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := prev[d-1+pk]
+		py := px - pk
+		// The edit took (px, py) to (sx, sy), followed by a run of equal tokens.
+		sx, sy := px+1, py
+		if pk == k+1 {
+			sx, sy = px, py+1
+		}
+		for x > sx {
+			x--
+			ops = append(ops, diffOp{opEqual, a[x]})
+		}
+		if sy > py {
+			ops = append(ops, diffOp{opInsert, b[py]})
+		} else {
+			ops = append(ops, diffOp{opDelete, a[px]})
+		}
+		x, y = px, py
+	}
+	for x > 0 {
+		x--
+		ops = append(ops, diffOp{opEqual, a[x]})
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
@@ -0,0 +1,73 @@
+package tmplfmt
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestFormatEdits(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []Edit
+	}{
+		{"{{ .A }}\n", nil},
+		{
+			"<p>{{.A}}</p>\n",
+			[]Edit{{Offset: 5, NewText: " "}, {Offset: 7, NewText: " "}},
+		},
+		{
+			"{{if   .X}}a{{end}}{{ .Y}}",
+			[]Edit{{Offset: 2, NewText: " "}, {Offset: 4, Length: 3, NewText: " "}, {Offset: 9, NewText: " "}, {Offset: 14, NewText: " "}, {Offset: 17, NewText: " "}, {Offset: 24, NewText: " "}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := FormatEdits(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalEdits(got, tt.want) {
+			t.Errorf("FormatEdits(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		out, _ := Format(tt.in)
+		if s := applyEdits(tt.in, got); s != out {
+			t.Errorf("FormatEdits(%q) yields %q, want %q", tt.in, s, out)
+		}
+	}
+}
+
+func equalEdits(a, b []Edit) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDiff(t *testing.T) {
+	words := []string{"a", "b", " ", "\n", "{", "}", "."}
+	random := func(r *rand.Rand) string {
+		var b strings.Builder
+		for i := r.Intn(20); i > 0; i-- {
+			b.WriteString(words[r.Intn(len(words))])
+		}
+		return b.String()
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		a, b := random(r), random(r)
+		edits := diff(a, b)
+		if got := applyEdits(a, edits); got != b {
+			t.Fatalf("diff(%q, %q) = %+v, which yields %q", a, b, edits, got)
+		}
+		for j := 1; j < len(edits); j++ {
+			if edits[j].Offset <= edits[j-1].Offset+edits[j-1].Length {
+				t.Fatalf("diff(%q, %q) = %+v: edits %d and %d touch", a, b, edits, j-1, j)
+			}
+		}
+	}
+}
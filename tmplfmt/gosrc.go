@@ -0,0 +1,111 @@
+package tmplfmt
+
+import (
+	"bytes"
+	"fmt"
+	goast "go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// goMarker is the comment that marks a raw string literal in Go source as a template.
+// gofmt rewrites it to "// gotmplfmt" in doc comments; both are accepted.
+const goMarker = "gotmplfmt"
+
+// FormatGo formats the templates in the Go source file src using the default options.
+func FormatGo(src string) (string, error) {
+	return Options{}.FormatGo(src)
+}
+
+// FormatGo formats the templates in the Go source file src using opts.
+//
+// A template is a raw string literal that is the sole argument of
+// a method named Parse, as in
+//
+//	template.Must(template.New("x").Parse(`...`))
+//
+// or that follows a // gotmplfmt comment, on the line before it
+// or earlier on the same line, as in
+//
+//	// gotmplfmt
+//	const tmpl = `...`
+//
+// Templates are rewritten in place. Interpreted string literals,
+// and templates whose formatted form contains a backquote, are left alone.
+// If src is gofmt-clean, so is the result.
+func (opts Options) FormatGo(src string) (string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+	marked := make(map[int]token.Pos) // line -> position of a //gotmplfmt comment ending on it
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			if strings.TrimSpace(strings.TrimPrefix(c.Text, "//")) == goMarker {
+				marked[fset.Position(c.End()).Line] = c.Pos()
+			}
+		}
+	}
+	var lits []*goast.BasicLit
+	goast.Inspect(f, func(n goast.Node) bool {
+		switch n := n.(type) {
+		case *goast.CallExpr:
+			sel, ok := n.Fun.(*goast.SelectorExpr)
+			if ok && sel.Sel.Name == "Parse" && len(n.Args) == 1 {
+				if lit, ok := n.Args[0].(*goast.BasicLit); ok && isRawString(lit) {
+					lits = append(lits, lit)
+				}
+			}
+		case *goast.BasicLit:
+			line := fset.Position(n.Pos()).Line
+			if _, ok := marked[line-1]; ok && isRawString(n) {
+				lits = append(lits, n)
+			} else if pos, ok := marked[line]; ok && pos < n.Pos() && isRawString(n) {
+				lits = append(lits, n)
+			}
+		}
+		return true
+	})
+	// A literal may be both marked and passed to Parse.
+	sort.Slice(lits, func(i, j int) bool { return lits[i].Pos() < lits[j].Pos() })
+	var out strings.Builder
+	last := 0
+	for i, lit := range lits {
+		if i > 0 && lit == lits[i-1] {
+			continue
+		}
+		// Slice src rather than using lit.Value, from which the scanner strips carriage returns.
+		start := fset.Position(lit.ValuePos).Offset + 1
+		end := fset.Position(lit.End()).Offset - 1
+		formatted, err := opts.Format(src[start:end])
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", fset.Position(lit.ValuePos), err)
+		}
+		if strings.Contains(formatted, "`") {
+			continue
+		}
+		out.WriteString(src[last:start])
+		out.WriteString(formatted)
+		last = end
+	}
+	out.WriteString(src[last:])
+	result := out.String()
+	if clean, err := format.Source([]byte(src)); err == nil && bytes.Equal(clean, []byte(src)) {
+		// Changing the length of a literal may change the alignment of what follows it.
+		b, err := format.Source([]byte(result))
+		if err != nil {
+			return "", err
+		}
+		result = string(b)
+	}
+	return result, nil
+}
+
+// isRawString reports whether lit is a raw string literal.
+func isRawString(lit *goast.BasicLit) bool {
+	return lit.Kind == token.STRING && strings.HasPrefix(lit.Value, "`")
+}
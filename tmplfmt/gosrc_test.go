@@ -0,0 +1,49 @@
+package tmplfmt
+
+import "testing"
+
+func TestFormatGo(t *testing.T) {
+	const in = "package p\n" +
+		"\n" +
+		"var t = template.Must(template.New(\"x\").Parse(`{{if .A}}{{.B}}{{end}}`))\n" +
+		"\n" +
+		"// gotmplfmt\n" +
+		"const a = `{{.A}}`\n" +
+		"\n" +
+		"const b = `{{.B}}` // gotmplfmt is only honored before the literal\n" +
+		"\n" +
+		"var c = f.Parse(\"{{.C}}\")\n" +
+		"\n" +
+		"const (\n" +
+		"\t//gotmplfmt\n" +
+		"\td  = `{{.D}}` // d\n" +
+		"\tee = \"e\"      // e\n" +
+		")\n"
+	const want = "package p\n" +
+		"\n" +
+		"var t = template.Must(template.New(\"x\").Parse(`{{ if .A }}{{ .B }}{{ end }}`))\n" +
+		"\n" +
+		"// gotmplfmt\n" +
+		"const a = `{{ .A }}`\n" +
+		"\n" +
+		"const b = `{{.B}}` // gotmplfmt is only honored before the literal\n" +
+		"\n" +
+		"var c = f.Parse(\"{{.C}}\")\n" +
+		"\n" +
+		"const (\n" +
+		"\t//gotmplfmt\n" +
+		"\td  = `{{ .D }}` // d\n" +
+		"\tee = \"e\"        // e\n" +
+		")\n"
+	got, err := FormatGo(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("FormatGo:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := FormatGo("package p\n\nvar t = x.Parse(`\n{{ if }}`)\n"); err == nil || err.Error() != "3:17: template: 2: missing value for if" {
+		t.Errorf("FormatGo error = %v, want position of the template", err)
+	}
+}
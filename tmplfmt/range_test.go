@@ -0,0 +1,98 @@
+package tmplfmt
+
+import (
+	"strings"
+	"testing"
+)
+
+// In rangeTests, « and » mark the start and end of the range to format.
+var rangeTests = []struct {
+	name string
+	opts Options
+	in   string
+	want string
+}{
+	{
+		name: "action",
+		in:   "{{.A}}\n«{{.B}}»\n{{.C}}\n",
+		want: "{{.A}}\n{{ .B }}\n{{.C}}\n",
+	},
+	{
+		name: "partial-action",
+		in:   "{{.A}}\n{{.«B}}\n{{.C}}»\n",
+		want: "{{.A}}\n{{.B}}\n{{ .C }}\n",
+	},
+	{
+		name: "inside-branch",
+		in:   "{{if .X}}\n«{{.A}}\n{{else}}\n{{.B}}»\n{{end}}\n",
+		want: "{{if .X}}\n{{ .A }}\n{{else}}\n{{ .B }}\n{{end}}\n",
+	},
+	{
+		name: "whole-branch",
+		in:   "«{{if .X}}{{.A}}{{end}}»{{.B}}",
+		want: "{{ if .X }}{{ .A }}{{ end }}{{.B}}",
+	},
+	{
+		name: "else-branch",
+		in:   "{{if .X}}{{.A}}«{{else}}{{.B}}{{end}}»",
+		want: "{{if .X}}{{.A}}{{ else }}{{ .B }}{{ end }}",
+	},
+	{
+		name: "off",
+		in:   "«{{.A}}{{/* gotmplfmt:off */}}{{.B}}{{/* gotmplfmt:on */}}{{.C}}»",
+		want: "{{ .A }}{{/* gotmplfmt:off */}}{{.B}}{{/* gotmplfmt:on */}}{{ .C }}",
+	},
+	{
+		name: "ignore",
+		in:   "{{/* gotmplfmt:ignore */}}\n«{{.A}}»\n",
+		want: "{{/* gotmplfmt:ignore */}}\n{{.A}}\n",
+	},
+	{
+		// Collapsing the else if would need the outer end, which is out of range.
+		name: "no-collapse",
+		opts: Options{ElseIf: ElseIfCollapse},
+		in:   "{{if .A}}a«{{else}}{{if .B}}b{{end}}»{{end}}",
+		want: "{{if .A}}a{{ else }}{{ if .B }}b{{ end }}{{end}}",
+	},
+	{
+		// Dropping the alias would need the with action, which is out of range.
+		name: "no-with-alias",
+		opts: Options{Simplify: true},
+		in:   "{{with $x := .}}{{$x.A}}«{{$x.B}}»{{end}}",
+		want: "{{with $x := .}}{{$x.A}}{{ $x.B }}{{end}}",
+	},
+	{
+		name: "simplify",
+		opts: Options{Simplify: true},
+		in:   "{{.A}}«{{printf \"%s\" (.B)}}»",
+		want: "{{.A}}{{ printf \"%s\" .B }}",
+	},
+	{
+		name: "empty",
+		in:   "{{.A}}«»{{.B}}",
+		want: "{{.A}}{{.B}}",
+	},
+}
+
+func TestFormatRange(t *testing.T) {
+	for _, tt := range rangeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := strings.Index(tt.in, "«")
+			in := strings.Replace(tt.in, "«", "", 1)
+			end := strings.Index(in, "»")
+			in = strings.Replace(in, "»", "", 1)
+			edits, err := tt.opts.FormatRange(in, start, end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, e := range edits {
+				if e.Offset < start || e.Offset+e.Length > end {
+					t.Errorf("edit %d = %+v is outside the range [%d, %d)", i, e, start, end)
+				}
+			}
+			if got := applyEdits(in, edits); got != tt.want {
+				t.Errorf("FormatRange(%q, %d, %d) yields\n%q\nwant\n%q", in, start, end, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package tmplfmt
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+const scriptPage = `<html>
+  <head>
+    <style>
+body {
+  color: {{ .Color }};
+  font-family: "{{ .Font }}", sans-serif;
+}
+    </style>
+    <script>
+var user = {{ .User }};
+var greeting = "Hello, {{ .User.Name }}";
+var re = /["'{]/;
+var tmpl = ` + "`" + `<b>
+  ${user.Name}</b>` + "`" + `;
+{{ if .Debug }}
+    console.log(user, {{ .Debug }});
+{{ end }}
+    </script>
+    <script type="application/ld+json">
+{"name": {{ .User.Name }}}
+    </script>
+  </head>
+  <body onload="init({{ .User.Name }})">
+    <p>{{ .User.Name }}</p>
+  </body>
+</html>
+`
+
+func TestIndentScriptsRender(t *testing.T) {
+	got, err := Options{IndentScripts: true}.Format(scriptPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "\n    \tvar greeting") || !strings.Contains(got, "\n    \t  color: {{ .Color }};") {
+		t.Errorf("scripts were not re-indented:\n%s", got)
+	}
+	if !strings.Contains(got, "`<b>\n  ${user.Name}</b>`") {
+		t.Errorf("template literal changed:\n%s", got)
+	}
+	again, err := Options{IndentScripts: true}.Format(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != got {
+		t.Errorf("IndentScripts is not idempotent:\nfirst:\n%s\nsecond:\n%s", got, again)
+	}
+
+	data := map[string]any{
+		"Color": "red; x: </style>",
+		"Font":  `Times "New" Roman`,
+		"User":  map[string]any{"Name": "</script><b>'x'"},
+		"Debug": true,
+	}
+	want := renderHTML(t, scriptPage, data)
+	out := renderHTML(t, got, data)
+	// Re-indenting changes the rendered page, but only in the leading
+	// whitespace of script and style lines, which browsers ignore.
+	if unindent(out) != unindent(want) {
+		t.Errorf("rendering changed:\nbefore:\n%s\nafter:\n%s", want, out)
+	}
+	wantLines, outLines := strings.Split(want, "\n"), strings.Split(out, "\n")
+	inScript := false
+	for i := range wantLines {
+		if i >= len(outLines) {
+			break
+		}
+		if !inScript && wantLines[i] != outLines[i] {
+			t.Errorf("rendered line %d outside scripts changed:\nbefore: %q\nafter:  %q", i+1, wantLines[i], outLines[i])
+		}
+		switch line := strings.TrimLeft(wantLines[i], " \t"); {
+		case strings.HasPrefix(line, "<script"), strings.HasPrefix(line, "<style"):
+			inScript = true
+		case strings.HasPrefix(line, "</script>"), strings.HasPrefix(line, "</style>"):
+			inScript = false
+		}
+	}
+	if out == want {
+		t.Errorf("rendering unchanged; want re-indented scripts")
+	}
+}
+
+func renderHTML(t *testing.T, text string, data any) string {
+	tmpl, err := template.New("page").Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+// unindent removes the leading whitespace of every line in s.
+func unindent(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimLeft(line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,82 @@
+package tmplfmt
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/josharian/gotmplfmt/ast"
+)
+
+// sameText reports whether the templates a and b differ only in whitespace inside delimiters.
+func sameText(a, b string) (bool, error) {
+	ka, err := textKey(a)
+	if err != nil {
+		return false, err
+	}
+	kb, err := textKey(b)
+	if err != nil {
+		return false, err
+	}
+	return ka == kb, nil
+}
+
+// textKey returns src with the whitespace inside delimiters normalized:
+// removed where it only surrounds punctuation and delimiters,
+// and otherwise, where it separates tokens as in {{ .A .B }} or {{- 3 }},
+// reduced to a single space.
+// Text, string literals, and character constants, in which whitespace is significant,
+// are kept intact.
+func textKey(src string) (string, error) {
+	tree, err := ast.ParseFile("", src)
+	if err != nil {
+		return "", err
+	}
+	var keep []ast.Node // in source order
+	ast.Inspect(tree.Root, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.TextNode, *ast.StringNode, *ast.NumberNode:
+			keep = append(keep, n)
+		}
+		return true
+	})
+	var sb strings.Builder
+	var prev rune // the last rune written to sb
+	squeeze := func(start, end int) {
+		for i := start; i < end; {
+			r, size := utf8.DecodeRuneInString(src[i:])
+			if !unicode.IsSpace(r) {
+				sb.WriteRune(r)
+				prev = r
+				i += size
+				continue
+			}
+			j := i
+			for j < end {
+				r, size := utf8.DecodeRuneInString(src[j:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				j += size
+			}
+			next, _ := utf8.DecodeRuneInString(src[j:])
+			if !strings.ContainsRune(punctuation, prev) && !strings.ContainsRune(punctuation, next) {
+				sb.WriteByte(' ')
+			}
+			i = j
+		}
+	}
+	last := 0
+	for _, n := range keep {
+		squeeze(last, int(n.Position()))
+		text := src[n.Position():n.End()]
+		sb.WriteString(text)
+		prev, _ = utf8.DecodeLastRuneInString(text)
+		last = int(n.End())
+	}
+	squeeze(last, len(src))
+	return sb.String(), nil
+}
+
+// punctuation holds the characters next to which whitespace inside delimiters never matters.
+const punctuation = "{}()|,:="
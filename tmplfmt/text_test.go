@@ -0,0 +1,46 @@
+package tmplfmt
+
+import "testing"
+
+func TestTextMode(t *testing.T) {
+	const in = "Dear {{.Name}},\n\n  {{- range .Items}}\n  * {{.}}{{end -}}\n{{ printf \"%s  %s\"\n.A\n.B }}\n"
+	const want = "Dear {{ .Name }},\n\n  {{- range .Items }}\n  * {{ . }}{{ end -}}\n{{ printf \"%s  %s\"\n\t.A\n\t.B\n}}\n"
+	got, err := Options{Mode: Text}.Format(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Format:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := (Options{Mode: Text, Simplify: true}).Format(in); err == nil {
+		t.Errorf("Format with Simplify in text mode succeeded, want error")
+	}
+}
+
+func TestSameText(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"a {{.A}}\n", "a {{ .A }}\n", true},
+		{"{{if .A}}x{{end}}", "{{ if .A }}x{{ end }}", true},
+		{"a {{.A}}", "a{{.A}}", false},
+		{`{{"a b"}}`, `{{ "ab" }}`, false},
+		{"{{.A}}", "{{.B}}", false},
+		{"{{.A|printf \"%v\"}}", "{{ .A | printf \"%v\" }}", true},
+		{"{{$x:=1}}{{eq $x\n\t1}}", "{{ $x := 1 }}{{ eq $x 1 }}", true},
+		{"{{ .A .B }}", "{{ .A.B }}", false},
+		{"{{- 3 }}", "{{ -3 }}", false},
+		{"{{ ' ' }}", "{{ '\t' }}", false},
+	}
+	for _, tt := range tests {
+		got, err := sameText(tt.a, tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("sameText(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
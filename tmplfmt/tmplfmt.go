@@ -1,15 +1,247 @@
 package tmplfmt
 
 import (
-	"github.com/josharian/gotmplfmt/internal/parse"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/josharian/gotmplfmt/ast"
+)
+
+// Options control optional formatting behavior.
+// The zero value formats without any optional rewrites.
+type Options struct {
+	// Mode selects the kind of document the template produces.
+	Mode Mode
+	// ElseIf selects how else-if chains are written.
+	ElseIf ElseIfStyle
+	// Simplify simplifies pipelines, like gofmt -s.
+	// See ast.Simplify for the rewrites it performs.
+	Simplify bool
+	// CanonicalStrings rewrites string literals to their canonical spelling:
+	// interpreted ("...") unless a raw string (`...`) avoids escapes.
+	CanonicalStrings bool
+	// CanonicalNumbers rewrites number literals to their canonical spelling:
+	// lowercase base prefixes and exponents, and no redundant + signs.
+	CanonicalNumbers bool
+	// IndentScripts re-indents the bodies of <script> and <style> elements
+	// relative to their start tags. It applies only in HTML mode.
+	// It is the one option that changes rendered output: the leading
+	// whitespace of script and style lines is template text, so it renders.
+	// See ast.IndentScripts for details.
+	IndentScripts bool
+}
+
+// Mode selects the kind of document a template produces.
+// Formatting never changes a template's output in any mode,
+// except for the script indentation that IndentScripts adds;
+// the mode adjusts layout to suit the document.
+type Mode int
+
+const (
+	HTML Mode = iota // HTML and other documents in which indentation is insignificant
+	// YAML, such as Helm charts, in which indentation is significant.
+	// Multiline actions are indented with spaces, never tabs.
+	// As in every mode, text outside delimiters is left as written:
+	// lines are not re-indented to follow the nesting of if, range, and with,
+	// so block scalars and the text around indent and nindent pipelines keep
+	// their indentation. The YAML itself is not parsed or checked.
+	YAML
+	// Text, such as emails, generated code, and configuration files,
+	// in which all whitespace may be significant.
+	// Only whitespace inside delimiters changes:
+	// the optional rewrites are not allowed, and the result is checked.
+	Text
+)
+
+// ModeForFile returns the mode suited to the file with the given name:
+// YAML for .yaml, .yml, and .tpl (Helm helpers), Text for .txt.tmpl and .go.tmpl,
+// and HTML otherwise.
+func ModeForFile(name string) Mode {
+	if strings.HasSuffix(name, ".txt.tmpl") || strings.HasSuffix(name, ".go.tmpl") {
+		return Text
+	}
+	switch path.Ext(name) {
+	case ".yaml", ".yml", ".tpl":
+		return YAML
+	}
+	return HTML
+}
+
+// ElseIfStyle selects how else-if chains are written.
+type ElseIfStyle int
+
+const (
+	ElseIfAsIs     ElseIfStyle = iota // leave else-if chains as written
+	ElseIfCollapse                    // rewrite {{ else }}{{ if X }} to {{ else if X }} where equivalent
+	ElseIfExpand                      // rewrite {{ else if X }} to {{ else }}{{ if X }}
 )
 
+// Format formats text using the default options.
 func Format(text string) (string, error) {
-	root, err := parse.Parse(text)
+	return Options{}.Format(text)
+}
+
+// Format formats text using opts.
+func (opts Options) Format(text string) (string, error) {
+	root, err := opts.parse(text, false)
 	if err != nil {
 		return "", err
 	}
-	// TODO: probably want to move all the printing logic out of the nodes
-	// and into something more flexible here.
-	return root.String(), nil
+	if root == nil {
+		return text, nil
+	}
+	out := opts.printConfig().Sprint(root)
+	if err := opts.check(text, out); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// parse parses text and applies the rewrites that opts requests.
+// It returns a nil root if text should not be formatted at all.
+// If partial is set, only part of text will be printed,
+// so parse skips the rewrites that change several actions together.
+func (opts Options) parse(text string, partial bool) (*ast.ListNode, error) {
+	if opts.Mode == Text && opts.rewrites() {
+		return nil, errors.New("rewrites are not allowed in text mode")
+	}
+	tree, err := ast.ParseFile("", text)
+	if err != nil {
+		return nil, err
+	}
+	root := tree.Root
+	if ast.Ignored(root) {
+		return nil, nil
+	}
+	if opts.IndentScripts && opts.Mode == HTML {
+		ast.IndentScripts(root, "\t")
+	}
+	switch {
+	case opts.Simplify && partial:
+		ast.SimplifyPipes(root)
+	case opts.Simplify:
+		ast.Simplify(root)
+	}
+	if opts.CanonicalStrings {
+		ast.CanonicalizeStrings(root)
+	}
+	if opts.CanonicalNumbers {
+		ast.CanonicalizeNumbers(root)
+	}
+	switch {
+	case partial:
+	case opts.ElseIf == ElseIfCollapse:
+		ast.CollapseElseIf(root)
+	case opts.ElseIf == ElseIfExpand:
+		ast.ExpandElseIf(root)
+	}
+	return root, nil
+}
+
+// printConfig returns the configuration for printing in opts's mode.
+func (opts Options) printConfig() ast.PrintConfig {
+	var cfg ast.PrintConfig
+	if opts.Mode == YAML {
+		cfg.Indent = "  "
+	}
+	return cfg
+}
+
+// check verifies that formatting text as out kept the promises of opts's mode.
+func (opts Options) check(text, out string) error {
+	if opts.Mode != Text {
+		return nil
+	}
+	same, err := sameText(text, out)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return errors.New("internal error: formatting changed text outside delimiters")
+	}
+	return nil
+}
+
+// rewrites reports whether opts requests any of the optional rewrites.
+func (opts Options) rewrites() bool {
+	return opts.ElseIf != ElseIfAsIs || opts.Simplify || opts.CanonicalStrings || opts.CanonicalNumbers || opts.IndentScripts
+}
+
+// An Edit replaces Length bytes at Offset in a template with NewText.
+type Edit struct {
+	Offset  int
+	Length  int
+	NewText string
+}
+
+// FormatRange formats the part of src between the byte offsets start and end
+// using the default options.
+func FormatRange(src string, start, end int) ([]Edit, error) {
+	return Options{}.FormatRange(src, start, end)
+}
+
+// FormatRange formats the part of src between the byte offsets start and end
+// using opts. It reformats only the text, comments, actions, and control
+// structures that lie entirely within the range, leaving the rest of src
+// byte-identical, and returns the changes as edits in increasing offset order.
+// It returns no edits if src should not be formatted at all.
+// Rewrites that span several actions, such as opts.ElseIf
+// and the with alias of opts.Simplify, are not applied to a range.
+func (opts Options) FormatRange(src string, start, end int) ([]Edit, error) {
+	root, err := opts.parse(src, true)
+	if err != nil || root == nil {
+		return nil, err
+	}
+	cfg := opts.printConfig()
+	var edits []Edit
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		pos, npos := int(n.Position()), int(n.End())
+		if npos <= start || end <= pos {
+			return false
+		}
+		switch n.(type) {
+		case *ast.TextNode, *ast.CommentNode, *ast.ActionNode, *ast.BranchNode, *ast.ElseNode, *ast.EndNode:
+		default:
+			// Lists have no text of their own,
+			// and nodes inside actions are formatted with their action.
+			_, list := n.(*ast.ListNode)
+			return list
+		}
+		if pos < start || end < npos {
+			// Format only the nodes within n that are in range.
+			return true
+		}
+		if ast.Unformatted(root, n.Position()) {
+			return false
+		}
+		if out := cfg.Sprint(n); out != src[pos:npos] {
+			edits = append(edits, Edit{Offset: pos, Length: npos - pos, NewText: out})
+		}
+		return false
+	})
+	out := applyEdits(src, edits)
+	if _, err := ast.ParseFile("", out); err != nil {
+		return nil, errors.New("internal error: formatting range produced an invalid template")
+	}
+	if err := opts.check(src, out); err != nil {
+		return nil, err
+	}
+	return edits, nil
+}
+
+// applyEdits returns src with edits, which must be in increasing offset order, applied.
+func applyEdits(src string, edits []Edit) string {
+	var b strings.Builder
+	last := 0
+	for _, e := range edits {
+		b.WriteString(src[last:e.Offset])
+		b.WriteString(e.NewText)
+		last = e.Offset + e.Length
+	}
+	b.WriteString(src[last:])
+	return b.String()
 }
@@ -0,0 +1,139 @@
+package tmplfmt
+
+import (
+	"testing"
+	"text/template"
+)
+
+var formatTests = []struct {
+	name string
+	in   string
+	want string
+}{
+	{
+		name: "comment-trim",
+		in:   "a {{- /* c */ -}}   b {{/* d */ -}}\n",
+		want: "a {{- /* c */ -}}   b {{/* d */ -}}\n",
+	},
+	{
+		name: "comment-placement",
+		in:   "{{.A}} {{/* trailing */}}\n\t{{/* own line */}}\n{{.B}}\n",
+		want: "{{ .A }} {{/* trailing */}}\n\t{{/* own line */}}\n{{ .B }}\n",
+	},
+	{
+		name: "align",
+		in: `{{ template "x" (dict
+	"a" 1
+	"longer" (list 1 2)
+	"bb" .Foo
+) }}`,
+		want: `{{ template "x" (dict
+		"a"      1
+		"longer" (list 1 2)
+		"bb"     .Foo
+	)
+}}`,
+	},
+	{
+		name: "align-blank-line",
+		in: `{{ dict
+	"a" 1
+	"bb" 2
+
+	"ccc" 3
+}}`,
+		want: `{{ dict
+	"a"  1
+	"bb" 2
+
+	"ccc" 3
+}}`,
+	},
+	{
+		name: "align-multiline-value",
+		in: `{{ dict
+	"a" 1
+	"bb" (list 1
+		2)
+	"ccc" 3
+	"d" 4
+}}`,
+		want: `{{ dict
+	"a" 1
+	"bb" (list 1
+		2
+	)
+	"ccc" 3
+	"d"   4
+}}`,
+	},
+	{
+		name: "off-on",
+		in: `{{.Z}}{{/* gotmplfmt:off */}}
+{{.A}}  {{   f   .B}}
+{{/* gotmplfmt:on */}}{{.C}}`,
+		want: `{{ .Z }}{{/* gotmplfmt:off */}}
+{{.A}}  {{   f   .B}}
+{{/* gotmplfmt:on */}}{{ .C }}`,
+	},
+	{
+		name: "off-until-end",
+		in:   `{{if .A}}{{.A}}{{/* gotmplfmt:off */}}{{.B}}{{else}}{{.C}}{{/*gotmplfmt:off*/}} {{.D}} {{end}}{{.E}}`,
+		want: `{{ if .A }}{{ .A }}{{/* gotmplfmt:off */}}{{.B}}{{ else }}{{ .C }}{{/*gotmplfmt:off*/}} {{.D}} {{ end }}{{ .E }}`,
+	},
+	{
+		name: "ignore",
+		in: `{{.A}}
+{{/* gotmplfmt:ignore */}}
+{{if .B}}{{end}}`,
+		want: `{{.A}}
+{{/* gotmplfmt:ignore */}}
+{{if .B}}{{end}}`,
+	},
+}
+
+func TestFormat(t *testing.T) {
+	for _, tt := range formatTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Format(%q):\ngot:\n%s\nwant:\n%s", tt.in, got, tt.want)
+			}
+			again, err := Format(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != got {
+				t.Errorf("Format is not idempotent:\nfirst:\n%s\nsecond:\n%s", got, again)
+			}
+		})
+	}
+}
+
+// Rewrites that span several actions must not reach into gotmplfmt:off regions,
+// which are printed as written.
+func TestRewritesOff(t *testing.T) {
+	tests := []struct {
+		opts Options
+		in   string
+	}{
+		{Options{Simplify: true}, `{{ with $x := . }}{{/* gotmplfmt:off */}}{{ $x.A }}{{/* gotmplfmt:on */}}{{ end }}`},
+		{Options{ElseIf: ElseIfCollapse}, `{{ if .A }}{{ else }}{{ if .B }}{{/* gotmplfmt:off */}}{{ .B }}{{ end }}{{ end }}`},
+		{Options{ElseIf: ElseIfExpand}, `{{ if .A }}{{ else if .B }}{{/* gotmplfmt:off */}}{{ .B }}{{ end }}`},
+	}
+	for _, tt := range tests {
+		got, err := tt.opts.Format(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.in {
+			t.Errorf("Format(%q) = %q, want unchanged", tt.in, got)
+		}
+		if _, err := template.New("").Parse(got); err != nil {
+			t.Errorf("Format(%q) = %q, which does not parse: %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package tmplfmt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+const helmChart = `{{- define "labels" -}}
+app: {{ .name }}
+{{- range $k, $v := .extra }}
+{{ $k }}: {{ $v | quote }}
+{{- end }}
+{{- end -}}
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Values.name | default "app" }}
+  labels:
+    {{- include "labels" (dict
+      "name" .Values.name
+      "extra" .Values.labels
+    ) | nindent 4 }}
+spec:
+  replicas: {{ .Values.replicas }}
+  {{- if not (not .Values.env) }}
+  env:
+    {{- toYaml .Values.env | nindent 4 }}
+  {{- else }}{{ if .Values.debug }}
+  debug: true
+  {{- end }}{{ end }}
+  annotations:
+{{ include "labels" (dict "name" "x" "extra" (dict)) | indent 4 }}
+`
+
+// helmFuncs returns stubs for the Helm and sprig functions used by helmChart.
+// include is bound to *t, which must be set before executing.
+func helmFuncs(t **template.Template) template.FuncMap {
+	return template.FuncMap{
+		"include": func(name string, data any) (string, error) {
+			var sb strings.Builder
+			err := (*t).ExecuteTemplate(&sb, name, data)
+			return sb.String(), err
+		},
+		"indent": func(n int, s string) string {
+			pad := strings.Repeat(" ", n)
+			return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+		},
+		"nindent": func(n int, s string) string {
+			pad := strings.Repeat(" ", n)
+			return "\n" + pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+		},
+		"quote": func(v any) string { return fmt.Sprintf("%q", fmt.Sprint(v)) },
+		"default": func(d, v any) any {
+			if v == nil || v == "" {
+				return d
+			}
+			return v
+		},
+		"dict": func(kv ...any) map[string]any {
+			m := make(map[string]any)
+			for i := 0; i+1 < len(kv); i += 2 {
+				m[kv[i].(string)] = kv[i+1]
+			}
+			return m
+		},
+		"toYaml": func(v map[string]any) string {
+			var keys []string
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			var lines []string
+			for _, k := range keys {
+				lines = append(lines, fmt.Sprintf("%s: %v", k, v[k]))
+			}
+			return strings.Join(lines, "\n")
+		},
+	}
+}
+
+func renderHelm(t *testing.T, text string, values map[string]any) string {
+	var tmpl *template.Template
+	tmpl = template.Must(template.New("chart").Funcs(helmFuncs(&tmpl)).Parse(text))
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, map[string]any{"Values": values}); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+func TestYAMLMode(t *testing.T) {
+	opts := Options{
+		Mode:             YAML,
+		ElseIf:           ElseIfCollapse,
+		Simplify:         true,
+		CanonicalStrings: true,
+		CanonicalNumbers: true,
+	}
+	got, err := opts.Format(helmChart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "\t") {
+		t.Errorf("YAML mode output contains tabs:\n%s", got)
+	}
+	if !strings.Contains(got, "{{- include \"labels\" (dict\n        \"name\"  .Values.name\n        \"extra\" .Values.labels\n      ) | nindent 4\n    }}") {
+		t.Errorf("YAML mode did not lay out the multiline include:\n%s", got)
+	}
+
+	for _, values := range []map[string]any{
+		{"name": "web", "replicas": 3, "labels": map[string]any{"tier": "front", "n": 1}, "env": map[string]any{"A": 1, "B": "b"}},
+		{"replicas": 1, "debug": true},
+		{"name": "", "replicas": 0},
+	} {
+		want := renderHelm(t, helmChart, values)
+		if out := renderHelm(t, got, values); out != want {
+			t.Errorf("rendering with %v changed:\nbefore:\n%s\nafter:\n%s", values, want, out)
+		}
+	}
+}
+
+const helmBlocks = `data:
+  script.sh: |
+    #!/bin/sh
+    {{- range .Values.hosts }}
+    ping {{.}}
+      {{- if $.Values.verbose }}
+    echo   "verbose  {{.}}"
+      {{- end }}
+    {{- end }}
+  config: |-
+{{.Values.config|indent 4}}
+  list:
+    {{- if .Values.list }}
+      {{- range $i, $x := .Values.list }}
+    - {{$i}}: {{$x}}
+      {{- end }}
+    {{- end }}
+`
+
+// TestYAMLText checks that YAML mode keeps the text of block scalars
+// and of nested control structures exactly as written.
+func TestYAMLText(t *testing.T) {
+	got, err := Options{Mode: YAML, Simplify: true}.Format(helmBlocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same, err := sameText(helmBlocks, got); err != nil || !same {
+		t.Errorf("YAML mode changed text outside delimiters (err %v):\n%s", err, got)
+	}
+	if !strings.Contains(got, "{{ .Values.config | indent 4 }}") {
+		t.Errorf("indent pipeline not kept:\n%s", got)
+	}
+	for _, values := range []map[string]any{
+		{"hosts": []string{"a", "b"}, "verbose": true, "config": "x: 1\ny: 2", "list": []int{3, 4}},
+		{"hosts": []string{"a"}, "config": ""},
+	} {
+		want := renderHelm(t, helmBlocks, values)
+		if out := renderHelm(t, got, values); out != want {
+			t.Errorf("rendering with %v changed:\nbefore:\n%s\nafter:\n%s", values, want, out)
+		}
+	}
+}